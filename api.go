@@ -1,46 +1,241 @@
 package vagrantcloud
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	baseUrl = "https://vagrantcloud.com"
-	apiUri  = "/api/v1"
+	apiUri  = "/api/"
 )
 
 type Api struct {
-	token string
+	source     TokenSource
+	secrets    *secrets
+	baseUrl    string
+	client     *http.Client
+	queryToken bool
+	version    ApiVersion
+	retry      RetryPolicy
+	limiter    *limiter
+	inflight   chan struct{}
+	dryRun     *dryRun
+
+	uploadTimeout time.Duration
+}
+
+// Option configures an Api created by New or NewFromFile.
+type Option func(*Api)
+
+// WithBaseUrl points the Api at another Vagrant Cloud endpoint,
+// such as an internal mirror or an httptest server.
+// Defaults to https://vagrantcloud.com.
+func WithBaseUrl(u string) Option {
+	return func(a *Api) {
+		a.baseUrl = strings.TrimRight(u, "/")
+	}
+}
+
+// WithHttpClient sets the http.Client used for every request,
+// e.g. one with a proxy or timeouts configured.
+// Defaults to http.DefaultClient.
+func WithHttpClient(c *http.Client) Option {
+	return func(a *Api) {
+		a.client = c
+	}
 }
 
-// All requests must be authenticated with an access_token and sent as a URL parameter.
+// WithQueryToken sends the access token as the access_token URL parameter
+// (or form field) instead of the Authorization header.
+// This is the legacy behaviour of the v1 API;
+// the token may end up in proxy and server logs.
+func WithQueryToken() Option {
+	return func(a *Api) {
+		a.queryToken = true
+	}
+}
+
+// All requests must be authenticated with an access_token,
+// which is sent as an "Authorization: Bearer" header unless WithQueryToken is given.
 // This token can be generated or revoked on the account tokens page.
 // Your token will have access to all resources your account has access to.
-func New(token string) *Api {
+//
+// Pass an empty token together with WithTokenSource
+// to look the token up for every request instead.
+func New(token string, opts ...Option) *Api {
 	a := &Api{
-		token: token,
+		secrets: &secrets{},
+		baseUrl: baseUrl,
+		client:  http.DefaultClient,
+		version: ApiV1,
+
+		uploadTimeout: time.Minute,
+	}
+	if token != "" {
+		a.source = StaticTokenSource(token)
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
 	return a
 }
 
-func NewFromFile(fname string) (*Api, error) {
-	token, err := ioutil.ReadFile("token.txt")
-	if err != nil {
+// NewFromFile reads the access token from the file fname for every request,
+// so a rotated token is picked up without creating a new Api.
+func NewFromFile(fname string, opts ...Option) (*Api, error) {
+	source := FileTokenSource(fname)
+	if _, err := source.Token(); err != nil {
 		return nil, err
 	}
-	return New(string(token)), nil
+	return New("", append([]Option{WithTokenSource(source)}, opts...)...), nil
 }
 
 func (a *Api) buildUrl(url string) string {
-	return baseUrl + apiUri + url
+	return a.baseUrl + apiUri + string(a.version) + url
 }
 
 func (a *Api) contentType(header http.Header) {
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if a.version == ApiV2 {
+		header.Set("Content-Type", "application/json")
+	} else {
+		header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+}
+
+// accessToken asks the token source for the token of the next request.
+func (a *Api) accessToken() (string, error) {
+	if a.source == nil {
+		return "", nil
+	}
+	token, err := a.source.Token()
+	if err != nil {
+		return "", err
+	}
+	a.secrets.add(token)
+	return token, nil
+}
+
+func (a *Api) authorize(req *http.Request) error {
+	if a.legacyToken() || !a.ownHost(req.URL) {
+		return nil
+	}
+	token, err := a.accessToken()
+	if err == nil && token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return err
+}
+
+// ownHost reports whether u points at the Api's own endpoint,
+// the only host the access token may be sent to.
+func (a *Api) ownHost(u *url.URL) bool {
+	base, err := url.Parse(a.baseUrl)
+	return err == nil && strings.EqualFold(base.Host, u.Host)
+}
+
+func (a *Api) legacyToken() bool {
+	return a.queryToken && a.version != ApiV2
+}
+
+func (a *Api) authorizeQuery(u *url.URL) error {
+	if !a.legacyToken() {
+		return nil
+	}
+	token, err := a.accessToken()
+	if err == nil && token != "" {
+		q := u.Query()
+		q.Set("access_token", token)
+		u.RawQuery = q.Encode()
+	}
+	return err
+}
+
+func (a *Api) authorizeParams(params url.Values) error {
+	if !a.legacyToken() {
+		return nil
+	}
+	token, err := a.accessToken()
+	if err == nil && token != "" {
+		params.Set("access_token", token)
+	}
+	return err
+}
+
+// secrets remembers every access token handed out by the token source,
+// so that rotated tokens are redacted too.
+type secrets struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (s *secrets) add(token string) {
+	if token == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		if t == token {
+			return
+		}
+	}
+	s.tokens = append(s.tokens, token)
+}
+
+func (s *secrets) redact(str string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.tokens {
+		str = strings.Replace(str, t, "REDACTED", -1)
+		str = strings.Replace(str, url.QueryEscape(t), "REDACTED", -1)
+	}
+	return str
+}
+
+// redact scrubs the access tokens from err,
+// so that errors such as *url.Error never carry them into logs.
+func (a *Api) redact(err error) error {
+	if err == nil {
+		return err
+	}
+	if e, ok := err.(*url.Error); ok {
+		err = &url.Error{
+			Op:  e.Op,
+			URL: a.redactString(e.URL),
+			Err: a.redact(e.Err),
+		}
+	}
+	if s := err.Error(); s != a.redactString(s) {
+		return &redactedError{
+			msg: a.redactString(s),
+			err: err,
+		}
+	}
+	return err
+}
+
+func (a *Api) redactString(s string) string {
+	return a.secrets.redact(s)
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
 }
 
 func (a *Api) response(resp *http.Response) ([]byte, error) {
@@ -50,109 +245,165 @@ func (a *Api) response(resp *http.Response) ([]byte, error) {
 		return nil, err
 	}
 	if resp.StatusCode != 200 {
-		return body, NewError(resp.Status, string(body))
+		return body, newResponseError(resp, body)
 	}
 	return body, nil
 }
 
-func (a *Api) Get(uri string) ([]byte, error) {
-	u, err := url.ParseRequestURI(a.buildUrl(uri))
+func (a *Api) do(req *http.Request) ([]byte, error) {
+	if err := a.authorize(req); err != nil {
+		return nil, a.redact(err)
+	}
+	body, err := a.doRetry(req)
+	return body, a.redact(err)
+}
+
+func (a *Api) send(req *http.Request) ([]byte, error) {
+	release, err := a.acquire(req.Context())
 	if err != nil {
 		return nil, err
 	}
-	q := u.Query()
-	q.Set("access_token", a.token)
-	u.RawQuery = q.Encode()
-	resp, err := http.Get(u.String())
+	defer release()
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	return a.response(resp)
 }
 
-func (a *Api) Download(uri string, data io.Writer) error {
-	u, err := url.ParseRequestURI(baseUrl + uri)
+func (a *Api) Get(uri string) ([]byte, error) {
+	return a.GetContext(context.Background(), uri)
+}
+
+func (a *Api) GetContext(ctx context.Context, uri string) ([]byte, error) {
+	if a.dryRun != nil && !readOnly("GET", uri) {
+		return a.dryRun.get(ctx, a, uri)
+	}
+	return a.get(ctx, uri)
+}
+
+func (a *Api) get(ctx context.Context, uri string) ([]byte, error) {
+	u, err := url.ParseRequestURI(a.buildUrl(uri))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := a.authorizeQuery(u); err != nil {
+		return nil, a.redact(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
 	}
-	q := u.Query()
-	q.Set("access_token", a.token)
-	u.RawQuery = q.Encode()
-	resp, err := http.Get(u.String())
+	return a.do(req)
+}
+
+func (a *Api) Download(uri string, data io.Writer) error {
+	return a.DownloadContext(context.Background(), uri, data)
+}
+
+// DownloadContext writes the file at uri, relative to the Api's endpoint, to data.
+// Redirects are followed, but the access token is not sent to other hosts.
+// A non-2xx response is returned as an *Error and nothing is written.
+func (a *Api) DownloadContext(ctx context.Context, uri string, data io.Writer) error {
+	resp, release, err := a.download(ctx, uri, 0)
 	if err != nil {
 		return err
 	}
+	defer release()
 	defer resp.Body.Close()
 	_, err = io.Copy(data, resp.Body)
-	return err
+	return a.redact(err)
 }
 
 func (a *Api) Post(uri string, params url.Values) ([]byte, error) {
+	return a.PostContext(context.Background(), uri, params)
+}
+
+func (a *Api) PostContext(ctx context.Context, uri string, params url.Values) ([]byte, error) {
+	if a.dryRun != nil && !readOnly("POST", uri) {
+		return a.dryRun.record(ctx, a, "POST", uri, params)
+	}
 	u, err := url.ParseRequestURI(a.buildUrl(uri))
 	if err != nil {
 		return nil, err
 	}
-	params.Set("access_token", a.token)
-	resp, err := http.PostForm(u.String(), params)
+	if err := a.authorizeParams(params); err != nil {
+		return nil, a.redact(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), a.encode(params))
 	if err != nil {
 		return nil, err
 	}
-	return a.response(resp)
+	a.contentType(req.Header)
+	return a.do(req)
 }
 
 func (a *Api) Put(uri string, params url.Values) ([]byte, error) {
+	return a.PutContext(context.Background(), uri, params)
+}
+
+func (a *Api) PutContext(ctx context.Context, uri string, params url.Values) ([]byte, error) {
+	if a.dryRun != nil {
+		return a.dryRun.record(ctx, a, "PUT", uri, params)
+	}
 	u, err := url.ParseRequestURI(a.buildUrl(uri))
 	if err != nil {
 		return nil, err
 	}
-	params.Set("access_token", a.token)
-	req, err := http.NewRequest("PUT", u.String(), strings.NewReader(params.Encode()))
-	if err != nil {
-		return nil, err
+	if err := a.authorizeParams(params); err != nil {
+		return nil, a.redact(err)
 	}
-	a.contentType(req.Header)
-	resp, err := http.DefaultClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, "PUT", u.String(), a.encode(params))
 	if err != nil {
 		return nil, err
 	}
-	return a.response(resp)
+	a.contentType(req.Header)
+	return a.do(req)
 }
 
 func (a *Api) Upload(uri string, data io.Reader) ([]byte, error) {
+	return a.UploadContext(context.Background(), uri, data)
+}
+
+func (a *Api) UploadContext(ctx context.Context, uri string, data io.Reader) ([]byte, error) {
+	if a.dryRun != nil {
+		return a.dryRun.record(ctx, a, "PUT", uri, nil)
+	}
 	u, err := url.ParseRequestURI(a.buildUrl(uri))
 	if err != nil {
 		return nil, err
 	}
-	q := u.Query()
-	q.Set("access_token", a.token)
-	u.RawQuery = q.Encode()
-	req, err := http.NewRequest("PUT", u.String(), data)
-	if err != nil {
-		return nil, err
+	if err := a.authorizeQuery(u); err != nil {
+		return nil, a.redact(err)
 	}
-	req.Header.Set("Content-Type", "multipart/form-data")
-	resp, err := http.DefaultClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, "PUT", u.String(), data)
 	if err != nil {
 		return nil, err
 	}
-	return a.response(resp)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return a.do(req)
 }
 
 func (a *Api) Delete(uri string) ([]byte, error) {
+	return a.DeleteContext(context.Background(), uri)
+}
+
+func (a *Api) DeleteContext(ctx context.Context, uri string) ([]byte, error) {
+	if a.dryRun != nil {
+		return a.dryRun.record(ctx, a, "DELETE", uri, nil)
+	}
 	u, err := url.ParseRequestURI(a.buildUrl(uri))
 	if err != nil {
 		return nil, err
 	}
 	params := url.Values{}
-	params.Add("access_token", a.token)
-	req, err := http.NewRequest("DELETE", u.String(), strings.NewReader(params.Encode()))
-	if err != nil {
-		return nil, err
+	if err := a.authorizeParams(params); err != nil {
+		return nil, a.redact(err)
 	}
-	a.contentType(req.Header)
-	resp, err := http.DefaultClient.Do(req)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", u.String(), a.encode(params))
 	if err != nil {
 		return nil, err
 	}
-	return a.response(resp)
+	a.contentType(req.Header)
+	return a.do(req)
 }
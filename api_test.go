@@ -1,16 +1,63 @@
 package vagrantcloud_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"github.com/larryli/vagrantcloud.v1"
+	"github.com/larryli/vagrantcloud.v1/vagrantcloudtest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
+var record = flag.Bool("record", false, "record TestApi against Vagrant Cloud using token.txt")
+
+// TestApi replays testdata/TestApi.json, recorded from Vagrant Cloud;
+// run it with -record and a token.txt to record the fixture again.
 func TestApi(t *testing.T) {
-	url := "https://cloud-images.ubuntu.com/vagrant/trusty/current/trusty-server-cloudimg-i386-vagrant-disk1.box"
-	a, err := vagrantcloud.NewFromFile("token.txt")
+	fixture := filepath.Join("testdata", "TestApi.json")
+	if *record {
+		c := vagrantcloudtest.NewRecorder(fixture, nil)
+		a, err := vagrantcloud.NewFromFile("token.txt", vagrantcloud.WithHttpClient(c.Client()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatal(err)
+		}
+		testApi(t, a)
+		if err := c.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	c, err := vagrantcloudtest.LoadCassette(fixture)
+	if os.IsNotExist(err) {
+		t.Skip(fixture + " has not been recorded, run TestApi with -record")
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
+	testApi(t, vagrantcloud.New("token", vagrantcloud.WithHttpClient(c.Client())))
+	if unused := c.Unused(); len(unused) > 0 {
+		t.Fatalf("%d interactions were not replayed", len(unused))
+	}
+}
+
+func testApi(t *testing.T, a *vagrantcloud.Api) {
+	url := "https://cloud-images.ubuntu.com/vagrant/trusty/current/trusty-server-cloudimg-i386-vagrant-disk1.box"
 	b := a.Box("", "test")
 	if err := b.New(); err != nil {
 		t.Fatal(err)
@@ -66,3 +113,942 @@ func TestApi(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestContextCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := a.Box("user", "test").GetContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestTokenHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.URL.Query().Get("access_token") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name":"test"}`))
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("secret", vagrantcloud.WithBaseUrl(ts.URL))
+	if err := a.Box("user", "test").Get(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenRedacted(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	a := vagrantcloud.New("secret", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithQueryToken())
+	b := a.Box("user", "test")
+	for _, f := range []func() error{b.Get, b.Set, b.Delete} {
+		err := f()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Fatalf("token leaked: %v", err)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"errors":{"name":["has already been taken"]},"success":false}`))
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	err := a.Box("user", "test").New()
+	var e *vagrantcloud.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if e.StatusCode != http.StatusUnprocessableEntity || e.Method != "POST" || e.Path != "/api/v1/boxes" {
+		t.Fatalf("unexpected error %#v", e)
+	}
+	if msgs := e.Errors["name"]; len(msgs) != 1 || msgs[0] != "has already been taken" {
+		t.Fatalf("unexpected field errors %v", e.Errors)
+	}
+	if !vagrantcloud.IsConflict(err) || vagrantcloud.IsNotFound(err) {
+		t.Fatalf("unexpected classification of %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var posts, gets int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			posts++
+			if posts == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":{"name":["has already been taken"]}}`))
+		case "GET":
+			gets++
+			if gets < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"name":"test","username":"user"}`))
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+		RetryPost:   true,
+	}))
+	if err := a.Box("user", "test").New(); err != nil {
+		t.Fatal(err)
+	}
+	if posts != 2 || gets != 3 {
+		t.Fatalf("unexpected attempts: %d posts, %d gets", posts, gets)
+	}
+
+	posts, gets = 0, 0
+	a = vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{
+		MinBackoff: time.Millisecond,
+	}))
+	if err := a.Box("user", "test").Get(); err != nil {
+		t.Fatal(err)
+	}
+	if gets != 3 {
+		t.Fatalf("unexpected attempts: %d gets, want the default 3", gets)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	var mu sync.Mutex
+	var current, peak int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		current++
+		if current > peak {
+			peak = current
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		current--
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL),
+		vagrantcloud.WithRateLimit(1000, 10), vagrantcloud.WithMaxInFlight(3))
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Get("/box/user/test"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak != 3 {
+		t.Fatalf("%d requests in flight at most, want 3", peak)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL),
+		vagrantcloud.WithRateLimit(20, 1), vagrantcloud.WithMaxInFlight(2))
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := a.Get("/box/user/test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Fatalf("5 requests at 20/s took only %v", d)
+	}
+}
+
+func TestUploadFileResume(t *testing.T) {
+	data := strings.Repeat("box", 1000)
+	fname := filepath.Join(t.TempDir(), "test.box")
+	if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var received []byte
+	var checksum string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/upload"):
+			w.Write([]byte(`{"upload_path":"/upload/object","token":"hosted"}`))
+		case r.Method == "GET":
+			if string(received) == data {
+				w.Write([]byte(`{"name":"virtualbox","hosted":true,"hosted_token":"hosted"}`))
+			} else {
+				w.Write([]byte(`{"name":"virtualbox"}`))
+			}
+		case r.URL.Path != "/upload/object":
+			checksum = r.FormValue("provider[checksum_type]") + ":" + r.FormValue("provider[checksum]")
+			w.Write([]byte(`{"name":"virtualbox","hosted":true,"hosted_token":"hosted"}`))
+		case r.Header.Get("Authorization") != "Bearer token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", len(data)):
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(received)-1))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			if int64(len(body)) != r.ContentLength {
+				t.Errorf("body length %d, Content-Length %d", len(body), r.ContentLength)
+			}
+			if len(received) == 0 {
+				received = body[:1000]
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			received = append(received, body...)
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL),
+		vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{MinBackoff: time.Millisecond}))
+	var done int64
+	p := a.Box("user", "test").Version("0.0.1").Provider(vagrantcloud.ProviderVirtualbox)
+	p.ChecksumType = vagrantcloud.ChecksumSha256
+	if err := p.UploadFile(fname, func(n, total int64) { done = n }); err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != data || done != int64(len(data)) {
+		t.Fatalf("received %d bytes, progress %d, want %d", len(received), done, len(data))
+	}
+	if !p.Hosted || p.HostedToken != "hosted" {
+		t.Fatalf("upload not confirmed: %+v", p)
+	}
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data))); checksum != want {
+		t.Fatalf("saved checksum %q, want %q", checksum, want)
+	}
+}
+
+func TestUploadFileResumeComplete(t *testing.T) {
+	data := strings.Repeat("box", 1000)
+	fname := filepath.Join(t.TempDir(), "test.box")
+	if err := ioutil.WriteFile(fname, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var received []byte
+	var checksum string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/upload"):
+			w.Write([]byte(`{"upload_path":"/upload/object","token":"hosted"}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"name":"virtualbox","hosted":true,"hosted_token":"hosted"}`))
+		case r.URL.Path != "/upload/object":
+			checksum = r.FormValue("provider[checksum_type]") + ":" + r.FormValue("provider[checksum]")
+			w.Write([]byte(`{"name":"virtualbox","hosted":true,"hosted_token":"hosted"}`))
+		case r.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", len(data)):
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(received)-1))
+			w.WriteHeader(http.StatusPermanentRedirect)
+		case received != nil:
+			t.Errorf("file sent again with Content-Range %q", r.Header.Get("Content-Range"))
+		default:
+			// the whole file arrives but the answer is lost
+			received, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL),
+		vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{MinBackoff: time.Millisecond}))
+	var done int64
+	p := a.Box("user", "test").Version("0.0.1").Provider(vagrantcloud.ProviderVirtualbox)
+	p.ChecksumType = vagrantcloud.ChecksumSha256
+	if err := p.UploadFile(fname, func(n, total int64) { done = n }); err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != data || done != int64(len(data)) {
+		t.Fatalf("received %d bytes, progress %d, want %d", len(received), done, len(data))
+	}
+	if want := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(data))); checksum != want {
+		t.Fatalf("saved checksum %q, want %q", checksum, want)
+	}
+}
+
+func TestUploadHostedTokenMismatch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/upload"):
+			w.Write([]byte(`{"upload_path":"/upload/object","token":"hosted"}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"name":"virtualbox","hosted_token":"stale"}`))
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithUploadTimeout(0))
+	p := a.Box("user", "test").Version("0.0.1").Provider(vagrantcloud.ProviderVirtualbox)
+	var e *vagrantcloud.HostedTokenError
+	if err := p.Upload(strings.NewReader("box")); !errors.As(err, &e) || e.Got != "stale" {
+		t.Fatalf("expected hosted token mismatch, got %v", err)
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	data := strings.Repeat("box", 1000)
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("access token sent to storage")
+		}
+		http.ServeContent(w, r, "test.box", time.Time{}, strings.NewReader(data))
+	}))
+	defer storage.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user/test/version/0.0.1/provider/virtualbox.box":
+			http.Redirect(w, r, storage.URL+"/test.box", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	v := a.Box("user", "test").Version("0.0.1")
+
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "test.box")
+	if err := ioutil.WriteFile(fname+".part", []byte(data[:100]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := v.Provider(vagrantcloud.ProviderVirtualbox)
+	p.ChecksumType = vagrantcloud.ChecksumSha256
+	p.Checksum = fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+	if err := p.DownloadFile(fname, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(fname); string(b) != data {
+		t.Fatalf("downloaded %d bytes, want %d", len(b), len(data))
+	}
+
+	// a complete partial file is kept, a longer one downloaded again
+	for _, part := range []string{data, data + "stale"} {
+		os.Remove(fname)
+		if err := ioutil.WriteFile(fname+".part", []byte(part), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.DownloadFile(fname, nil); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := ioutil.ReadFile(fname); string(b) != data {
+			t.Fatalf("downloaded %d bytes, want %d", len(b), len(data))
+		}
+	}
+
+	// a checksum of unknown type is not verified
+	p.ChecksumType = ""
+	if err := p.DownloadFile(filepath.Join(dir, "untyped.box"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "untyped.box")); string(b) != data {
+		t.Fatalf("downloaded %d bytes, want %d", len(b), len(data))
+	}
+
+	p.ChecksumType = vagrantcloud.ChecksumSha256
+	p.Checksum = "bad"
+	var e *vagrantcloud.ChecksumError
+	if err := p.DownloadFile(filepath.Join(dir, "bad.box"), nil); !errors.As(err, &e) {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	err := v.Provider(vagrantcloud.ProviderAws).Download(&buf)
+	if !vagrantcloud.IsNotFound(err) || buf.Len() != 0 {
+		t.Fatalf("expected not found and no data, got %v and %d bytes", err, buf.Len())
+	}
+}
+
+func TestApiV2(t *testing.T) {
+	var got map[string]map[string]interface{}
+	var path string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected Content-Type %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"name":"virtualbox","architecture":"arm64","default_architecture":true}`))
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	p := a.Box("user", "test").Version("1.0.0").Provider(vagrantcloud.ProviderVirtualbox)
+	p.Architecture = vagrantcloud.ArchitectureArm64
+	p.DefaultArchitecture = true
+	if err := p.Set(); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/api/v2/box/user/test/version/1.0.0/provider/virtualbox/arm64" {
+		t.Fatalf("unexpected path %s", path)
+	}
+	if got["provider"]["architecture"] != "arm64" || got["provider"]["default_architecture"] != true {
+		t.Fatalf("unexpected body %v", got)
+	}
+
+	// a provider without architecture is unknown, and uploaded directly
+	var calls []string
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/upload/direct"):
+			w.Write([]byte(`{"upload_path":"/storage/object","callback":"/api/v2/callback"}`))
+		default:
+			w.Write([]byte(`{"name":"virtualbox","architecture":"unknown","hosted":true}`))
+		}
+	}))
+	defer ts.Close()
+	a = vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	p = a.Box("user", "test").Version("1.0.0").Provider(vagrantcloud.ProviderVirtualbox)
+	if err := p.New(); err != nil {
+		t.Fatal(err)
+	}
+	p.Architecture = ""
+	if err := p.Upload(strings.NewReader("box")); err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /api/v2/box/user/test/version/1.0.0/providers," +
+		"GET /api/v2/box/user/test/version/1.0.0/provider/virtualbox/unknown/upload/direct," +
+		"PUT /storage/object," +
+		"PUT /api/v2/callback," +
+		"GET /api/v2/box/user/test/version/1.0.0/provider/virtualbox/unknown"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1/search" || q.Get("q") != "ubuntu" || q.Get("provider") != "virtualbox" || q.Get("limit") != "2" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		switch q.Get("page") {
+		case "1":
+			w.Write([]byte(`{"boxes":[{"username":"a","name":"1"},{"username":"a","name":"2"}]}`))
+		case "2":
+			w.Write([]byte(`{"boxes":[{"username":"b","name":"3"}]}`))
+		case "3":
+			w.Write([]byte(`{"boxes":[{"username":"b","name":"4"}]}`))
+		case "4":
+			w.Write([]byte(`{"boxes":[]}`))
+		default:
+			t.Errorf("unexpected page %s", q.Get("page"))
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	it := a.Search("ubuntu", &vagrantcloud.SearchOptions{
+		Provider: vagrantcloud.ProviderVirtualbox,
+		Limit:    2,
+	})
+	var names []string
+	for it.Next() {
+		names = append(names, it.Box().Username+"/"+it.Box().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "a/1,a/2,b/3,b/4" {
+		t.Fatalf("unexpected boxes %v", names)
+	}
+}
+
+func TestUserBoxes(t *testing.T) {
+	var pages []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/api/v1/user/org/search" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		pages = append(pages, q.Get("page"))
+		switch q.Get("page") {
+		case "1":
+			w.Write([]byte(`{"boxes":[{"username":"org","name":"1"},{"username":"org","name":"2"}]}`))
+		case "2":
+			w.Write([]byte(`{"boxes":[{"username":"org","name":"3"}]}`))
+		case "3":
+			w.Write([]byte(`{"boxes":[]}`))
+		default:
+			t.Errorf("unexpected page %s", q.Get("page"))
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	var names []string
+	it := a.UserBoxes("org")
+	for it.Next() {
+		names = append(names, it.Box().Username+"/"+it.Box().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	it = a.OrganizationBoxes("org")
+	for it.Next() {
+		names = append(names, it.Box().Username+"/"+it.Box().Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "org/1,org/2,org/3,org/1,org/2,org/3" {
+		t.Fatalf("unexpected boxes %s", got)
+	}
+	if got := strings.Join(pages, ","); got != "1,2,3,1,2,3" {
+		t.Fatalf("unexpected pages %s", got)
+	}
+}
+
+func TestOrganization(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/user/org":
+			w.Write([]byte(`{"username":"org","boxes":[{"username":"org","name":"test"}]}`))
+		case "/api/v1/boxes":
+			w.Write([]byte(`{"username":"` + r.FormValue("box[username]") + `","name":"` + r.FormValue("box[name]") + `"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	o := a.Organization("org")
+	if err := o.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Members) != 0 || o.IsMember("user") || len(o.Boxes) != 1 || o.Boxes[0].Uri() != "/box/org/test" {
+		t.Fatalf("unexpected organization %+v", o)
+	}
+	b := o.Box("new")
+	if err := b.New(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Username != "org" {
+		t.Fatalf("box created under %q", b.Username)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		switch {
+		case r.Method == "POST" && auth == "" && r.FormValue("user[login]") == "user" && r.FormValue("user[password]") == "pass":
+			w.Write([]byte(`{"token":"minted","token_hash":"hash","description":"` + r.FormValue("token[description]") + `"}`))
+		case r.Method == "GET" && auth == "Bearer minted":
+			w.Write([]byte(`{}`))
+		case r.Method == "DELETE" && auth == "Bearer minted":
+			w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("", vagrantcloud.WithBaseUrl(ts.URL))
+	tok, err := a.Authenticate("user", "pass", "ci", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "minted" || tok.Description != "ci" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+	if err := vagrantcloud.New(tok.Token, vagrantcloud.WithBaseUrl(ts.URL)).ValidateToken(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ValidateToken(); !vagrantcloud.IsUnauthorized(err) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	if err := tok.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vagrantcloud.New(tok.Token, vagrantcloud.WithBaseUrl(ts.URL)).RevokeToken(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RevokeToken(); !vagrantcloud.IsUnauthorized(err) {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "token.txt")
+	netrc := filepath.Join(dir, "netrc")
+	if err := ioutil.WriteFile(netrc, []byte("machine example.com login a password b\nmachine vagrantcloud.com\n\tlogin user\n\tpassword fromnetrc\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv(vagrantcloud.EnvToken)
+	a := vagrantcloud.New("", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithTokenSource(vagrantcloud.ChainTokenSource{
+		vagrantcloud.EnvTokenSource(""),
+		vagrantcloud.FileTokenSource(fname),
+		vagrantcloud.NetrcTokenSource{File: netrc},
+	}))
+	for _, want := range []string{"fromnetrc", "old", "new"} {
+		switch want {
+		case "old", "new":
+			if err := ioutil.WriteFile(fname, []byte(want+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := a.Get("/box/user/test"); err != nil {
+			t.Fatal(err)
+		}
+		if auth != "Bearer "+want {
+			t.Fatalf("sent %q, want token %q", auth, want)
+		}
+	}
+}
+
+func TestResolveVersion(t *testing.T) {
+	var b vagrantcloud.Box
+	err := json.Unmarshal([]byte(`{"versions":[
+		{"version":"1.10.0","status":"active","providers":[{"name":"virtualbox"}]},
+		{"version":"1.2.0","status":"active","providers":[{"name":"virtualbox"},{"name":"hyperv"}]},
+		{"version":"1.2.9","status":"active","providers":[{"name":"hyperv"}]},
+		{"version":"2.0.0-beta.1","status":"active","providers":[{"name":"virtualbox"}]},
+		{"version":"2.0.0","status":"unreleased","providers":[{"name":"virtualbox"}]},
+		{"version":"0.9","status":"revoked","providers":[{"name":"virtualbox"}]}
+	]}`), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(b.Versions)
+	var order []string
+	for _, v := range b.Versions {
+		order = append(order, v.Version)
+	}
+	if got := strings.Join(order, " "); got != "0.9 1.2.0 1.2.9 1.10.0 2.0.0-beta.1 2.0.0" {
+		t.Fatalf("unexpected order %s", got)
+	}
+	if v := b.LatestVersion(); v == nil || v.Version != "1.10.0" {
+		t.Fatalf("unexpected latest version %v", v)
+	}
+
+	v, err := b.ResolveVersion("~> 1.2", "")
+	if err != nil || v.Version != "1.10.0" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	v, err = b.ResolveVersion("~> 1.2.0", "")
+	if err != nil || v.Version != "1.2.9" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	v, err = b.ResolveVersion("~> 1.2.0", vagrantcloud.ProviderVirtualbox)
+	if err != nil || v.Version != "1.2.0" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	v, err = b.ResolveVersion(">= 1.0, < 1.10", vagrantcloud.ProviderVirtualbox)
+	if err != nil || v.Version != "1.2.0" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	v, err = b.ResolveVersion("!= 1.10.0", vagrantcloud.ProviderVirtualbox)
+	if err != nil || v.Version != "1.2.0" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	v, err = b.ResolveVersion(">= 2.0.0-alpha", "")
+	if err != nil || v.Version != "2.0.0-beta.1" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	// revoked versions never match
+	if v, err := b.ResolveVersion("= 0.9", ""); err != vagrantcloud.ErrNoMatchingVersion {
+		t.Fatalf("expected no match, got %v %v", v, err)
+	}
+}
+
+func TestPublishRollback(t *testing.T) {
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "POST" && r.FormValue("provider[name]") == "aws":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":{"url":["is invalid"]}}`))
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/versions"):
+			w.Write([]byte(`{"version":"1.0.0","number":"1.0.0","status":"unreleased"}`))
+		default:
+			w.Write([]byte(`{"name":"virtualbox","original_url":"http://box"}`))
+		}
+	}))
+	defer ts.Close()
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	_, err := a.Box("user", "test").Publish(vagrantcloud.PublishSpec{
+		Version: "1.0.0",
+		Providers: []vagrantcloud.PublishProvider{
+			{Name: vagrantcloud.ProviderVirtualbox, Url: "http://box"},
+			{Name: vagrantcloud.ProviderAws, Url: "bad"},
+		},
+	})
+	var e *vagrantcloud.PublishError
+	if !errors.As(err, &e) || e.Step != "create provider aws" || len(e.Rollback) != 0 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := "POST /api/v1/box/user/test/versions," +
+		"POST /api/v1/box/user/test/version/1.0.0/providers," +
+		"POST /api/v1/box/user/test/version/1.0.0/providers," +
+		"DELETE /api/v1/box/user/test/version/1.0.0/provider/virtualbox," +
+		"DELETE /api/v1/box/user/test/version/1.0.0"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls\n%s\nwant\n%s", got, want)
+	}
+
+	// a version found taken by a retried POST may predate Publish and is kept
+	calls = nil
+	versionPosts := 0
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/versions"):
+			if versionPosts++; versionPosts == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":{"version":["has already been taken"]}}`))
+		case r.Method == "POST" && r.FormValue("provider[name]") == "aws":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"errors":{"url":["is invalid"]}}`))
+		case r.Method == "GET":
+			w.Write([]byte(`{"version":"1.0.0","number":"1.0.0","status":"unreleased"}`))
+		default:
+			w.Write([]byte(`{"name":"virtualbox","original_url":"http://box"}`))
+		}
+	})
+	a = vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{
+		MaxAttempts: 2,
+		MinBackoff:  time.Millisecond,
+		RetryPost:   true,
+	}))
+	_, err = a.Box("user", "test").Publish(vagrantcloud.PublishSpec{
+		Version: "1.0.0",
+		Providers: []vagrantcloud.PublishProvider{
+			{Name: vagrantcloud.ProviderVirtualbox, Url: "http://box"},
+			{Name: vagrantcloud.ProviderAws, Url: "bad"},
+		},
+	})
+	if !errors.As(err, &e) || e.Step != "create provider aws" || len(e.Rollback) != 0 {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = "POST /api/v1/box/user/test/versions," +
+		"POST /api/v1/box/user/test/versions," +
+		"GET /api/v1/box/user/test/version/1.0.0," +
+		"POST /api/v1/box/user/test/version/1.0.0/providers," +
+		"POST /api/v1/box/user/test/version/1.0.0/providers," +
+		"DELETE /api/v1/box/user/test/version/1.0.0/provider/virtualbox"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPlanApply(t *testing.T) {
+	var calls []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`{"username":"user","name":"test","short_description":"Test","versions":[
+				{"version":"1.0.0","number":"1.0.0","status":"active","providers":[{"name":"virtualbox","original_url":"http://old"}]},
+				{"version":"0.9.0","number":"0.9.0","status":"unreleased"}]}`))
+			return
+		}
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	m, err := vagrantcloud.ParseManifest([]byte(`{"boxes":[{
+		"username":"user","name":"test","short_description":"Test","prune":true,
+		"versions":[
+			{"version":"1.0.0","providers":[{"name":"virtualbox","url":"http://new"}]},
+			{"version":"1.1.0","providers":[{"name":"virtualbox","url":"http://box"}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := vagrantcloud.New("token", vagrantcloud.WithBaseUrl(ts.URL))
+	plan, err := a.Plan(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, action := range plan.Actions {
+		actions = append(actions, action.String())
+	}
+	want := "update provider user/test 1.0.0 virtualbox (url)," +
+		"create version user/test 1.1.0," +
+		"create provider user/test 1.1.0 virtualbox," +
+		"release version user/test 1.1.0," +
+		"delete version user/test 0.9.0"
+	if got := strings.Join(actions, ","); got != want {
+		t.Fatalf("unexpected plan\n%s\nwant\n%s", got, want)
+	}
+	if err := a.Apply(plan); err != nil {
+		t.Fatal(err)
+	}
+	want = "PUT /api/v1/box/user/test/version/1.0.0/provider/virtualbox," +
+		"POST /api/v1/box/user/test/versions," +
+		"POST /api/v1/box/user/test/version/1.1.0/providers," +
+		"PUT /api/v1/box/user/test/version/1.1.0/release," +
+		"DELETE /api/v1/box/user/test/version/0.9.0"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls\n%s\nwant\n%s", got, want)
+	}
+
+	calls = nil
+	err = a.Apply(&vagrantcloud.Plan{Actions: []vagrantcloud.Action{
+		{Kind: vagrantcloud.ActionDelete, Resource: vagrantcloud.ResourceProvider, Username: "user", Name: "test", Version: "1.0.0", Provider: vagrantcloud.ProviderVirtualbox},
+		{Kind: vagrantcloud.ActionRevoke, Resource: vagrantcloud.ResourceVersion, Username: "user", Name: "test", Version: "1.0.0"},
+		{Kind: vagrantcloud.ActionCreate, Resource: vagrantcloud.ResourceBox, Username: "user", Name: "other"},
+	}})
+	var applyErr *vagrantcloud.ApplyError
+	if !errors.As(err, &applyErr) || applyErr.Action.Name != "other" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want = "DELETE /api/v1/box/user/test/version/1.0.0/provider/virtualbox," +
+		"PUT /api/v1/box/user/test/version/1.0.0/revoke"
+	if got := strings.Join(calls, ","); got != want {
+		t.Fatalf("unexpected calls\n%s\nwant\n%s", got, want)
+	}
+
+	// v2 lists a provider created without architecture as unknown
+	v2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/api/v2/box/user/test" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"username":"user","name":"test","short_description":"Test","versions":[
+			{"version":"1.0.0","number":"1.0.0","status":"active","providers":[
+				{"name":"virtualbox","architecture":"unknown","original_url":"http://new"}]}]}`))
+	}))
+	defer v2.Close()
+	m, err = vagrantcloud.ParseManifest([]byte(`{"boxes":[{
+		"username":"user","name":"test","short_description":"Test","prune":true,
+		"versions":[{"version":"1.0.0","providers":[{"name":"virtualbox","url":"http://new"}]}]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a = vagrantcloud.New("token", vagrantcloud.WithBaseUrl(v2.URL), vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	plan, err = a.Plan(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Actions) != 0 {
+		t.Fatalf("unexpected plan %v", plan.Actions)
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	b := vagrantcloud.New("").Box("user", "test")
+	b.ShortDescription = "Test"
+	b.Versions = vagrantcloud.Versions{
+		{Version: "1.0.0", Status: vagrantcloud.VersionActive, Providers: []vagrantcloud.Provider{
+			{Name: vagrantcloud.ProviderVirtualbox, OriginalUrl: "http://box", Checksum: "abc", ChecksumType: vagrantcloud.ChecksumSha256},
+		}},
+		{Version: "1.1.0", Status: vagrantcloud.VersionUnreleased},
+	}
+	data, err := b.MarshalCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := vagrantcloud.ParseCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "user" || c.Name != "test" || c.ShortDescription != "Test" || len(c.Versions) != 1 {
+		t.Fatalf("unexpected catalog %s", data)
+	}
+	p := c.Versions[0].Providers[0]
+	if c.Versions[0].Version != "1.0.0" || p.DownloadUrl != "http://box" || p.Checksum != "abc" || p.ChecksumType != vagrantcloud.ChecksumSha256 {
+		t.Fatalf("unexpected catalog %s", data)
+	}
+}
+
+func TestCatalogServer(t *testing.T) {
+	store := vagrantcloud.NewMemoryStore()
+	b := vagrantcloud.New("").Box("user", "test")
+	b.Versions = vagrantcloud.Versions{
+		{Version: "1.0.0", Status: vagrantcloud.VersionActive, Providers: []vagrantcloud.Provider{
+			{Name: vagrantcloud.ProviderVirtualbox},
+			{Name: vagrantcloud.ProviderAws, OriginalUrl: "http://aws/box"},
+		}},
+	}
+	store.Add(b)
+	store.AddFile("user", "test", "1.0.0", vagrantcloud.ProviderVirtualbox, "", []byte("box data"))
+	ts := httptest.NewServer(&vagrantcloud.CatalogServer{Store: store})
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/user/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c, err := vagrantcloud.ParseCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps := c.Versions[0].Providers
+	if ps[0].DownloadUrl != ts.URL+"/user/test/version/1.0.0/provider/virtualbox.box" || ps[1].DownloadUrl != "http://aws/box" {
+		t.Fatalf("unexpected catalog %s", data)
+	}
+
+	req, _ := http.NewRequest("GET", ps[0].DownloadUrl, nil)
+	req.Header.Set("Range", "bytes=4-")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(data) != "data" {
+		t.Fatalf("unexpected response %d %q", resp.StatusCode, data)
+	}
+
+	resp, err = http.Get(ts.URL + "/user/missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	vdir := filepath.Join(dir, "user", "test", "1.0.0")
+	os.MkdirAll(vdir, 0755)
+	ioutil.WriteFile(filepath.Join(vdir, "virtualbox-arm64.box"), []byte("box"), 0644)
+	ioutil.WriteFile(filepath.Join(vdir, "virtualbox-arm64.box.sha256"), []byte("abc  virtualbox-arm64.box\n"), 0644)
+	b, err := vagrantcloud.DirStore(dir).Box("user", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Versions) != 1 || len(b.Versions[0].Providers) != 1 {
+		t.Fatalf("unexpected box %+v", b)
+	}
+	p := b.Versions[0].Providers[0]
+	if p.Name != vagrantcloud.ProviderVirtualbox || p.Architecture != vagrantcloud.ArchitectureArm64 || p.Checksum != "abc" || p.ChecksumType != vagrantcloud.ChecksumSha256 {
+		t.Fatalf("unexpected provider %+v", p)
+	}
+	f, err := vagrantcloud.DirStore(dir).Open("user", "test", "1.0.0", vagrantcloud.ProviderVirtualbox, vagrantcloud.ArchitectureArm64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := vagrantcloud.DirStore(dir).Box("user", "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
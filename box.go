@@ -1,6 +1,7 @@
 package vagrantcloud
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 	"strconv"
@@ -21,7 +22,7 @@ type Box struct {
 	Username            string    `json:"username"`
 	Private             bool      `json:"private"`
 	CurrentVersion      Version   `json:"current_version"`
-	Versions            []Version `json:"versions"`
+	Versions            Versions  `json:"versions"`
 }
 
 func (a *Api) Box(username, name string) *Box {
@@ -56,7 +57,11 @@ func (b *Box) Uri() string {
 
 // RETRIEVE A BOX
 func (b *Box) Get() error {
-	body, err := b.api.Get(b.Uri())
+	return b.GetContext(context.Background())
+}
+
+func (b *Box) GetContext(ctx context.Context) error {
+	body, err := b.api.GetContext(ctx, b.Uri())
 	if err != nil {
 		return err
 	}
@@ -74,6 +79,7 @@ func (b *Box) Get() error {
 //		The username to assign the box to.
 //		You must be a member of the organization and have the ability to create boxes.
 //		Defaults to the users username that is making the API request.
+//		May be an organization name, see Organization.Box.
 // 	ShortDescription
 //		The short description is used on small box previews,
 //		in search results and other places where displaying markdown isn't functional.
@@ -85,6 +91,10 @@ func (b *Box) Get() error {
 // 	Private
 //		A boolean if the box should be private or not.
 func (b *Box) New() error {
+	return b.NewContext(context.Background())
+}
+
+func (b *Box) NewContext(ctx context.Context) error {
 	params := url.Values{}
 	params.Add("box[name]", b.Name)
 	if b.Username != "" {
@@ -99,8 +109,11 @@ func (b *Box) New() error {
 	if b.Private {
 		params.Add("box[is_private]", strconv.FormatBool(b.Private))
 	}
-	body, err := b.api.Post("/boxes", params)
+	body, err := b.api.PostContext(ctx, "/boxes", params)
 	if err != nil {
+		if createdByRetry(err) {
+			return b.GetContext(ctx)
+		}
 		return err
 	}
 	return b.parseBody(body)
@@ -128,11 +141,15 @@ func (b *Box) New() error {
 // 	Private
 //		A boolean if the box should be private or not.
 func (b *Box) Set() error {
+	return b.SetContext(context.Background())
+}
+
+func (b *Box) SetContext(ctx context.Context) error {
 	params := url.Values{}
 	params.Add("box[short_description]", b.ShortDescription)
 	params.Add("box[description]", b.DescriptionMarkdown)
 	params.Add("box[is_private]", strconv.FormatBool(b.Private))
-	body, err := b.api.Put(b.Uri(), params)
+	body, err := b.api.PutContext(ctx, b.Uri(), params)
 	if err != nil {
 		return err
 	}
@@ -151,7 +168,11 @@ func (b *Box) Set() error {
 //		You must be a member of the organization and have the ability to create boxes.
 //		Defaults to the users username that is making the API request.
 func (b *Box) Delete() error {
-	body, err := b.api.Delete(b.Uri())
+	return b.DeleteContext(context.Background())
+}
+
+func (b *Box) DeleteContext(ctx context.Context) error {
+	body, err := b.api.DeleteContext(ctx, b.Uri())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,120 @@
+package vagrantcloud
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// catalog is the box metadata Vagrant reads from a self-hosted catalog,
+// e.g. `vagrant box add https://boxes.example.com/user/box/metadata.json`.
+type catalog struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Versions    []catalogVersion `json:"versions"`
+}
+
+type catalogVersion struct {
+	Version     string            `json:"version"`
+	Description string            `json:"description,omitempty"`
+	Providers   []catalogProvider `json:"providers"`
+}
+
+type catalogProvider struct {
+	Name                ProviderName `json:"name"`
+	Url                 string       `json:"url"`
+	Checksum            string       `json:"checksum,omitempty"`
+	ChecksumType        ChecksumType `json:"checksum_type,omitempty"`
+	Architecture        Architecture `json:"architecture,omitempty"`
+	DefaultArchitecture bool         `json:"default_architecture,omitempty"`
+}
+
+// catalog lists the active versions of b, with the provider urls given by url.
+func (b *Box) catalog(url func(v *Version, p *Provider) string) *catalog {
+	c := &catalog{
+		Name:        b.Username + "/" + b.Name,
+		Description: b.ShortDescription,
+		Versions:    []catalogVersion{},
+	}
+	for n := range b.Versions {
+		v := &b.Versions[n]
+		if v.Status != VersionActive {
+			continue
+		}
+		cv := catalogVersion{
+			Version:     v.Version,
+			Description: v.DescriptionMarkdown,
+			Providers:   []catalogProvider{},
+		}
+		if cv.Version == "" {
+			cv.Version = v.Number
+		}
+		for n := range v.Providers {
+			p := &v.Providers[n]
+			cv.Providers = append(cv.Providers, catalogProvider{
+				Name:                p.Name,
+				Url:                 url(v, p),
+				Checksum:            p.Checksum,
+				ChecksumType:        p.ChecksumType,
+				Architecture:        p.Architecture,
+				DefaultArchitecture: p.DefaultArchitecture,
+			})
+		}
+		c.Versions = append(c.Versions, cv)
+	}
+	return c
+}
+
+// MarshalCatalog renders the box as the metadata.json of a self-hosted catalog,
+// which `vagrant box add` accepts by url.
+// Only active versions are listed;
+// providers point at their OriginalUrl, or at their DownloadUrl if hosted.
+func (b *Box) MarshalCatalog() ([]byte, error) {
+	c := b.catalog(func(v *Version, p *Provider) string {
+		if p.OriginalUrl != "" {
+			return p.OriginalUrl
+		}
+		return p.DownloadUrl
+	})
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// ParseCatalog reads the metadata.json of a self-hosted catalog.
+// The returned Box is not bound to an Api; the provider urls are in DownloadUrl.
+func ParseCatalog(data []byte) (*Box, error) {
+	c := &catalog{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	i := strings.IndexByte(c.Name, '/')
+	if i < 0 {
+		return nil, errors.New("vagrantcloud: catalog name " + c.Name + " is not user/box")
+	}
+	b := &Box{
+		Tag:              c.Name,
+		Username:         c.Name[:i],
+		Name:             c.Name[i+1:],
+		ShortDescription: c.Description,
+	}
+	for _, cv := range c.Versions {
+		v := Version{
+			Version:             cv.Version,
+			Number:              cv.Version,
+			Status:              VersionActive,
+			DescriptionMarkdown: cv.Description,
+		}
+		for _, cp := range cv.Providers {
+			v.Providers = append(v.Providers, Provider{
+				Name:                cp.Name,
+				DownloadUrl:         cp.Url,
+				Checksum:            cp.Checksum,
+				ChecksumType:        cp.ChecksumType,
+				Architecture:        cp.Architecture,
+				DefaultArchitecture: cp.DefaultArchitecture,
+			})
+		}
+		b.Versions = append(b.Versions, v)
+	}
+	b.init(nil)
+	return b, nil
+}
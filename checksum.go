@@ -0,0 +1,114 @@
+package vagrantcloud
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+)
+
+type ChecksumType string
+
+const (
+	ChecksumMd5    ChecksumType = "md5"
+	ChecksumSha1   ChecksumType = "sha1"
+	ChecksumSha256 ChecksumType = "sha256"
+	ChecksumSha384 ChecksumType = "sha384"
+	ChecksumSha512 ChecksumType = "sha512"
+)
+
+// NewHash returns a hash.Hash computing checksums of type t.
+func (t ChecksumType) NewHash() (hash.Hash, error) {
+	switch ChecksumType(strings.ToLower(string(t))) {
+	case ChecksumMd5:
+		return md5.New(), nil
+	case ChecksumSha1:
+		return sha1.New(), nil
+	case ChecksumSha256:
+		return sha256.New(), nil
+	case ChecksumSha384:
+		return sha512.New384(), nil
+	case ChecksumSha512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("vagrantcloud: unsupported checksum type %q", string(t))
+}
+
+// ChecksumError is returned when a box does not match its expected checksum.
+type ChecksumError struct {
+	Type ChecksumType
+	Want string
+	Got  string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("vagrantcloud: %s checksum mismatch, want %s, got %s", e.Type, e.Want, e.Got)
+}
+
+// VerifyChecksum checks that the file fname has the checksum sum of type t.
+func VerifyChecksum(fname string, t ChecksumType, sum string) error {
+	got, err := FileChecksum(fname, t)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(got, sum) {
+		return &ChecksumError{
+			Type: t,
+			Want: sum,
+			Got:  got,
+		}
+	}
+	return nil
+}
+
+// FileChecksum computes the checksum of type t of the file fname.
+func FileChecksum(fname string, t ChecksumType) (string, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h, err := t.NewHash()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ChecksumReader computes a checksum of everything read through it,
+// e.g. while a box is streamed to Provider.Upload.
+type ChecksumReader struct {
+	Type ChecksumType
+	r    io.Reader
+	h    hash.Hash
+}
+
+func NewChecksumReader(r io.Reader, t ChecksumType) (*ChecksumReader, error) {
+	h, err := t.NewHash()
+	if err != nil {
+		return nil, err
+	}
+	return &ChecksumReader{
+		Type: t,
+		r:    io.TeeReader(r, h),
+		h:    h,
+	}, nil
+}
+
+func (r *ChecksumReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Sum returns the hex encoded checksum of the data read so far.
+func (r *ChecksumReader) Sum() string {
+	return hex.EncodeToString(r.h.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package vagrantcloud
+
+import (
+	"context"
+)
+
+// Client is the box, version and provider api addressed by plain identifiers,
+// for code that wants to swap Vagrant Cloud for a fake in tests,
+// such as the mock in the vagrantcloudtest package.
+// *Api implements it.
+//
+// The values passed to the create and update methods only provide the fields
+// their Box, Version and Provider counterparts send;
+// the returned values are bound to the Api like those of Api.Box.
+type Client interface {
+	GetBox(ctx context.Context, username, name string) (Box, error)
+	CreateBox(ctx context.Context, box Box) (Box, error)
+	UpdateBox(ctx context.Context, box Box) (Box, error)
+	DeleteBox(ctx context.Context, username, name string) error
+
+	GetVersion(ctx context.Context, username, name, version string) (Version, error)
+	CreateVersion(ctx context.Context, username, name string, version Version) (Version, error)
+	UpdateVersion(ctx context.Context, username, name string, version Version) (Version, error)
+	DeleteVersion(ctx context.Context, username, name, version string) error
+	ReleaseVersion(ctx context.Context, username, name, version string) (Version, error)
+	RevokeVersion(ctx context.Context, username, name, version string) (Version, error)
+
+	GetProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture) (Provider, error)
+	CreateProvider(ctx context.Context, username, name, version string, provider Provider) (Provider, error)
+	UpdateProvider(ctx context.Context, username, name, version string, provider Provider) (Provider, error)
+	DeleteProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture) error
+	UploadProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture, fname string) error
+}
+
+var _ Client = (*Api)(nil)
+
+func (a *Api) GetBox(ctx context.Context, username, name string) (Box, error) {
+	b := a.Box(username, name)
+	err := b.GetContext(ctx)
+	return *b, err
+}
+
+func (a *Api) CreateBox(ctx context.Context, box Box) (Box, error) {
+	b := a.Box(box.Username, box.Name)
+	b.ShortDescription = box.ShortDescription
+	b.DescriptionMarkdown = box.DescriptionMarkdown
+	b.Private = box.Private
+	err := b.NewContext(ctx)
+	return *b, err
+}
+
+func (a *Api) UpdateBox(ctx context.Context, box Box) (Box, error) {
+	b := a.Box(box.Username, box.Name)
+	b.ShortDescription = box.ShortDescription
+	b.DescriptionMarkdown = box.DescriptionMarkdown
+	b.Private = box.Private
+	err := b.SetContext(ctx)
+	return *b, err
+}
+
+func (a *Api) DeleteBox(ctx context.Context, username, name string) error {
+	return a.Box(username, name).DeleteContext(ctx)
+}
+
+func (a *Api) GetVersion(ctx context.Context, username, name, version string) (Version, error) {
+	v := a.Box(username, name).Version(version)
+	err := v.GetContext(ctx)
+	return *v, err
+}
+
+func (a *Api) CreateVersion(ctx context.Context, username, name string, version Version) (Version, error) {
+	v := a.Box(username, name).Version(version.Version)
+	v.Version = version.Version
+	v.DescriptionMarkdown = version.DescriptionMarkdown
+	err := v.NewContext(ctx)
+	return *v, err
+}
+
+func (a *Api) UpdateVersion(ctx context.Context, username, name string, version Version) (Version, error) {
+	number := version.Number
+	if number == "" {
+		number = version.Version
+	}
+	v := a.Box(username, name).Version(number)
+	v.DescriptionMarkdown = version.DescriptionMarkdown
+	err := v.SetContext(ctx)
+	return *v, err
+}
+
+func (a *Api) DeleteVersion(ctx context.Context, username, name, version string) error {
+	return a.Box(username, name).Version(version).DeleteContext(ctx)
+}
+
+func (a *Api) ReleaseVersion(ctx context.Context, username, name, version string) (Version, error) {
+	v := a.Box(username, name).Version(version)
+	err := v.ReleaseContext(ctx)
+	return *v, err
+}
+
+func (a *Api) RevokeVersion(ctx context.Context, username, name, version string) (Version, error) {
+	v := a.Box(username, name).Version(version)
+	err := v.RevokeContext(ctx)
+	return *v, err
+}
+
+func (a *Api) provider(username, name, version string, provider ProviderName, arch Architecture) *Provider {
+	p := a.Box(username, name).Version(version).Provider(provider)
+	p.Architecture = arch
+	return p
+}
+
+func (a *Api) GetProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture) (Provider, error) {
+	p := a.provider(username, name, version, provider, arch)
+	err := p.GetContext(ctx)
+	return *p, err
+}
+
+func (a *Api) CreateProvider(ctx context.Context, username, name, version string, provider Provider) (Provider, error) {
+	p := a.provider(username, name, version, provider.Name, provider.Architecture)
+	p.setFields(&provider)
+	err := p.NewContext(ctx)
+	return *p, err
+}
+
+func (a *Api) UpdateProvider(ctx context.Context, username, name, version string, provider Provider) (Provider, error) {
+	p := a.provider(username, name, version, provider.Name, provider.Architecture)
+	p.setFields(&provider)
+	err := p.SetContext(ctx)
+	return *p, err
+}
+
+func (a *Api) DeleteProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture) error {
+	return a.provider(username, name, version, provider, arch).DeleteContext(ctx)
+}
+
+func (a *Api) UploadProvider(ctx context.Context, username, name, version string, provider ProviderName, arch Architecture, fname string) error {
+	return a.provider(username, name, version, provider, arch).UploadFileContext(ctx, fname, nil)
+}
+
+// setFields copies the fields sent by New and Set from o.
+func (p *Provider) setFields(o *Provider) {
+	p.OriginalUrl = o.OriginalUrl
+	p.Checksum = o.Checksum
+	p.ChecksumType = o.ChecksumType
+	p.DefaultArchitecture = o.DefaultArchitecture
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/larryli/vagrantcloud.v1"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const usage = `usage: vagrantcloud [flags] <command> [command flags] <args>
+
+commands:
+	box get|create|update|delete USER/NAME
+	version create|release|revoke|delete USER/NAME VERSION
+	provider create|update|delete USER/NAME VERSION PROVIDER
+	provider upload|download USER/NAME VERSION PROVIDER FILE
+	search [QUERY]
+
+Run "vagrantcloud <command> <subcommand> -h" for the command flags.
+
+flags:
+`
+
+var (
+	api     *vagrantcloud.Api
+	token   = flag.String("token", "", "access_token, defaults to $"+vagrantcloud.EnvToken)
+	format  = flag.String("format", "table", "output format, table or json")
+	baseUrl = flag.String("url", "", "Vagrant Cloud url, defaults to https://vagrantcloud.com")
+	v2      = flag.Bool("v2", false, "use the v2 api")
+)
+
+func fatal(err error, a ...interface{}) {
+	if err != nil {
+		a = append(a, err)
+		log.Fatalln(a...)
+	}
+}
+
+func usageExit() {
+	fmt.Fprint(os.Stderr, usage)
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// parse parses the flags of a subcommand and checks its number of arguments.
+func parse(fs *flag.FlagSet, args []string, n int, names string) []string {
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: vagrantcloud %s [flags] %s\n", fs.Name(), names)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Args()
+}
+
+// visited returns the names of the flags set on the command line.
+func visited(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+func splitTag(tag string) (string, string) {
+	i := strings.IndexByte(tag, '/')
+	if i <= 0 || i == len(tag)-1 {
+		log.Fatalln("invalid box \"" + tag + "\", want USER/NAME")
+	}
+	return tag[:i], tag[i+1:]
+}
+
+func box(args []string) {
+	if len(args) == 0 {
+		usageExit()
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("box "+cmd, flag.ExitOnError)
+	short := fs.String("short", "", "short description")
+	description := fs.String("description", "", "description in markdown")
+	private := fs.Bool("private", false, "private box")
+	args = parse(fs, args, 1, "USER/NAME")
+	b := api.Box(splitTag(args[0]))
+	switch cmd {
+	case "get":
+		fatal(b.Get(), "get "+args[0])
+	case "create":
+		b.ShortDescription = *short
+		b.DescriptionMarkdown = *description
+		b.Private = *private
+		fatal(b.New(), "create "+args[0])
+	case "update":
+		fatal(b.Get(), "get "+args[0])
+		set := visited(fs)
+		if set["short"] {
+			b.ShortDescription = *short
+		}
+		if set["description"] {
+			b.DescriptionMarkdown = *description
+		}
+		if set["private"] {
+			b.Private = *private
+		}
+		fatal(b.Set(), "update "+args[0])
+	case "delete":
+		fatal(b.Delete(), "delete "+args[0])
+	default:
+		usageExit()
+	}
+	printBox(b)
+}
+
+func version(args []string) {
+	if len(args) == 0 {
+		usageExit()
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("version "+cmd, flag.ExitOnError)
+	description := fs.String("description", "", "description in markdown")
+	args = parse(fs, args, 2, "USER/NAME VERSION")
+	v := api.Box(splitTag(args[0])).Version(args[1])
+	todo := args[0] + " " + args[1]
+	switch cmd {
+	case "create":
+		v.Version = args[1]
+		v.DescriptionMarkdown = *description
+		fatal(v.New(), "create "+todo)
+	case "release":
+		fatal(v.Release(), "release "+todo)
+	case "revoke":
+		fatal(v.Revoke(), "revoke "+todo)
+	case "delete":
+		fatal(v.Delete(), "delete "+todo)
+	default:
+		usageExit()
+	}
+	printVersions(v)
+}
+
+func provider(args []string) {
+	if len(args) == 0 {
+		usageExit()
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("provider "+cmd, flag.ExitOnError)
+	arch := fs.String("arch", "", "architecture, e.g. amd64 or arm64")
+	defaultArch := fs.Bool("default-arch", false, "default architecture")
+	boxUrl := fs.String("box-url", "", "url of a self-hosted box")
+	checksum := fs.String("checksum", "", "checksum of the box")
+	checksumType := fs.String("checksum-type", "", "md5, sha1, sha256, sha384 or sha512")
+	progress := fs.Bool("progress", false, "report upload and download progress")
+	n, names := 3, "USER/NAME VERSION PROVIDER"
+	if cmd == "upload" || cmd == "download" {
+		n, names = 4, names+" FILE"
+	}
+	args = parse(fs, args, n, names)
+	p := api.Box(splitTag(args[0])).Version(args[1]).Provider(vagrantcloud.ProviderName(args[2]))
+	p.Architecture = vagrantcloud.Architecture(*arch)
+	todo := args[0] + " " + args[1] + " " + args[2]
+	var report vagrantcloud.Progress
+	if *progress {
+		report = func(done, total int64) {
+			fmt.Fprintf(os.Stderr, "\r%d/%d bytes", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+	switch cmd {
+	case "create":
+		p.DefaultArchitecture = *defaultArch
+		p.OriginalUrl = *boxUrl
+		p.Checksum = *checksum
+		p.ChecksumType = vagrantcloud.ChecksumType(*checksumType)
+		fatal(p.New(), "create "+todo)
+	case "update":
+		fatal(p.Get(), "get "+todo)
+		set := visited(fs)
+		if set["default-arch"] {
+			p.DefaultArchitecture = *defaultArch
+		}
+		if set["box-url"] {
+			p.OriginalUrl = *boxUrl
+		}
+		if set["checksum"] {
+			p.Checksum = *checksum
+		}
+		if set["checksum-type"] {
+			p.ChecksumType = vagrantcloud.ChecksumType(*checksumType)
+		}
+		fatal(p.Set(), "update "+todo)
+	case "upload":
+		// a checksum type without checksum is computed while uploading
+		p.ChecksumType = vagrantcloud.ChecksumType(*checksumType)
+		fatal(p.UploadFile(args[3], report), "upload "+todo)
+	case "download":
+		// the checksum to verify comes with the provider
+		fatal(p.Get(), "get "+todo)
+		fatal(p.DownloadFile(args[3], report), "download "+todo)
+	case "delete":
+		fatal(p.Delete(), "delete "+todo)
+	default:
+		usageExit()
+	}
+	printProviders(p)
+}
+
+func search(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	prov := fs.String("provider", "", "only boxes with this provider")
+	sort := fs.String("sort", "", "downloads, created or updated")
+	order := fs.String("order", "", "desc or asc")
+	max := fs.Int("max", 25, "maximum number of boxes")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	it := api.Search(fs.Arg(0), &vagrantcloud.SearchOptions{
+		Provider: vagrantcloud.ProviderName(*prov),
+		Sort:     vagrantcloud.SearchSort(*sort),
+		Order:    vagrantcloud.SearchOrder(*order),
+	})
+	var boxes []*vagrantcloud.Box
+	for len(boxes) < *max && it.Next() {
+		boxes = append(boxes, it.Box())
+	}
+	fatal(it.Err(), "search")
+	printBox(boxes...)
+}
+
+func printJson(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	fatal(err, "json")
+	fmt.Println(string(data))
+}
+
+func table(header string, rows func(w *tabwriter.Writer)) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, header)
+	rows(w)
+	w.Flush()
+}
+
+func printBox(boxes ...*vagrantcloud.Box) {
+	if *format == "json" {
+		if len(boxes) == 1 {
+			printJson(boxes[0])
+		} else {
+			printJson(boxes)
+		}
+		return
+	}
+	table("TAG\tCURRENT\tVERSIONS\tPRIVATE\tDESCRIPTION", func(w *tabwriter.Writer) {
+		for _, b := range boxes {
+			fmt.Fprintf(w, "%s/%s\t%s\t%d\t%t\t%s\n", b.Username, b.Name, b.CurrentVersion.Version, len(b.Versions), b.Private, b.ShortDescription)
+		}
+	})
+}
+
+func printVersions(versions ...*vagrantcloud.Version) {
+	if *format == "json" {
+		printJson(versions[0])
+		return
+	}
+	table("VERSION\tSTATUS\tPROVIDERS", func(w *tabwriter.Writer) {
+		for _, v := range versions {
+			var names []string
+			for _, p := range v.Providers {
+				names = append(names, string(p.Name))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Number, v.Status, strings.Join(names, ","))
+		}
+	})
+}
+
+func printProviders(providers ...*vagrantcloud.Provider) {
+	if *format == "json" {
+		printJson(providers[0])
+		return
+	}
+	table("NAME\tARCH\tHOSTED\tURL\tCHECKSUM", func(w *tabwriter.Writer) {
+		for _, p := range providers {
+			url := p.OriginalUrl
+			if url == "" {
+				url = p.DownloadUrl
+			}
+			checksum := ""
+			if p.Checksum != "" {
+				checksum = string(p.ChecksumType) + ":" + p.Checksum
+			}
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\n", p.Name, p.Architecture, p.Hosted, url, checksum)
+		}
+	})
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = usageExit
+	flag.Parse()
+	if *format != "table" && *format != "json" {
+		usageExit()
+	}
+	opts := []vagrantcloud.Option{}
+	if *baseUrl != "" {
+		opts = append(opts, vagrantcloud.WithBaseUrl(*baseUrl))
+	}
+	if *v2 {
+		opts = append(opts, vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	}
+	// without a token only public boxes can be read
+	t, err := vagrantcloud.ChainTokenSource{
+		vagrantcloud.StaticTokenSource(*token),
+		vagrantcloud.EnvTokenSource(""),
+	}.Token()
+	if !errors.Is(err, vagrantcloud.ErrNoToken) {
+		fatal(err, "token")
+	}
+	api = vagrantcloud.New(t, opts...)
+	args := flag.Args()
+	if len(args) == 0 {
+		usageExit()
+	}
+	switch args[0] {
+	case "box":
+		box(args[1:])
+	case "version":
+		version(args[1:])
+	case "provider":
+		provider(args[1:])
+	case "search":
+		search(args[1:])
+	default:
+		usageExit()
+	}
+}
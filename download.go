@@ -0,0 +1,170 @@
+package vagrantcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// maxRedirects matches the limit of http.Client's default redirect policy.
+const maxRedirects = 10
+
+// redirectClient returns a copy of the Api's client
+// that drops the Authorization header when a download is redirected
+// away from the Api's own host, e.g. to the storage holding the box.
+func (a *Api) redirectClient() *http.Client {
+	c := *a.client
+	check := c.CheckRedirect
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !a.ownHost(req.URL) {
+			req.Header.Del("Authorization")
+		}
+		if check != nil {
+			return check(req, via)
+		}
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		return nil
+	}
+	return &c
+}
+
+// download starts a GET of uri, asking for the bytes after offset if it is positive.
+// The caller must close the response body and then call release.
+func (a *Api) download(ctx context.Context, uri string, offset int64) (*http.Response, func(), error) {
+	u, err := url.ParseRequestURI(a.baseUrl + uri)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := a.authorizeQuery(u); err != nil {
+		return nil, nil, a.redact(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if err := a.authorize(req); err != nil {
+		return nil, nil, a.redact(err)
+	}
+	release, err := a.acquire(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := a.redirectClient().Do(req)
+	if err != nil {
+		release()
+		return nil, nil, a.redact(err)
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		return resp, release, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer release()
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		return nil, nil, a.redact(newResponseError(resp, body))
+	}
+	return resp, release, nil
+}
+
+func (a *Api) DownloadFile(uri, fname string, progress Progress) error {
+	return a.DownloadFileContext(context.Background(), uri, fname, progress)
+}
+
+// DownloadFileContext downloads uri into the file fname.
+//
+// The data is written to fname + ".part" first,
+// which is renamed to fname once the download is complete.
+// If the partial file already exists, the download resumes after it
+// with an HTTP Range request, or starts over if the server ignores the range.
+// A partial file the server reports as no shorter than the remote file
+// is complete if it has the same size, and downloaded again otherwise.
+func (a *Api) DownloadFileContext(ctx context.Context, uri, fname string, progress Progress) error {
+	part := fname + ".part"
+	if err := a.downloadFile(ctx, uri, part, progress); err != nil {
+		return err
+	}
+	return os.Rename(part, fname)
+}
+
+// downloadFile downloads uri into the file part, resuming after its current size.
+func (a *Api) downloadFile(ctx context.Context, uri, part string, progress Progress) error {
+	f, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = a.downloadTo(ctx, uri, f, offset, progress)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (a *Api) downloadTo(ctx context.Context, uri string, f *os.File, offset int64, progress Progress) error {
+	resp, release, err := a.download(ctx, uri, offset)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		resp.Body.Close()
+		release()
+		var size int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &size); err == nil && size == offset {
+			// the partial file is already complete
+			return nil
+		}
+		// the partial file is longer than the remote one, or of unknown length
+		if err := truncate(f); err != nil {
+			return err
+		}
+		return a.downloadTo(ctx, uri, f, 0, progress)
+	}
+	defer release()
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPartialContent {
+		var start int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); err != nil || start != offset {
+			return errors.New("vagrantcloud: unexpected Content-Range " + resp.Header.Get("Content-Range"))
+		}
+	} else {
+		offset = 0
+		if err := truncate(f); err != nil {
+			return err
+		}
+	}
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	r := &progressReader{
+		r:        resp.Body,
+		done:     offset,
+		total:    total,
+		progress: progress,
+	}
+	_, err = io.Copy(f, r)
+	return a.redact(err)
+}
+
+// truncate empties f to write it again from the start.
+func truncate(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
@@ -0,0 +1,328 @@
+package vagrantcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Change is a mutation recorded instead of sent by an Api created WithDryRun.
+type Change struct {
+	Method string
+	// Uri is relative to the api endpoint, e.g. /box/user/name/versions.
+	Uri    string
+	Params url.Values
+	// File is the local box file an upload would have sent, if any.
+	File string
+}
+
+func (c Change) String() string {
+	s := c.Method + " " + c.Uri
+	if len(c.Params) > 0 {
+		s += " " + c.Params.Encode()
+	}
+	if c.File != "" {
+		s += " < " + c.File
+	}
+	return s
+}
+
+// WithDryRun turns every mutation (Post, Put, Upload and Delete,
+// and so every New, Set, Delete, Release, Revoke and Upload) into a no-op
+// recorded in Changes.
+// Reads still go to Vagrant Cloud, but reflect the recorded changes:
+// a box created in a dry run can be retrieved, a deleted one is not found.
+// Authenticate and ValidateToken change nothing and are sent as usual.
+// A box must be created with its Username, as the one of the token is not known.
+// This gives any tool built on the package a plan mode for free.
+func WithDryRun() Option {
+	return func(a *Api) {
+		a.dryRun = &dryRun{
+			states: map[string]*dryState{},
+		}
+	}
+}
+
+// Changes returns the mutations recorded in dry-run mode, in order.
+func (a *Api) Changes() []Change {
+	if a.dryRun == nil {
+		return nil
+	}
+	a.dryRun.mu.Lock()
+	defer a.dryRun.mu.Unlock()
+	return append([]Change(nil), a.dryRun.changes...)
+}
+
+type dryRun struct {
+	mu      sync.Mutex
+	changes []Change
+	// states holds the intended state of every resource changed, by uri.
+	states map[string]*dryState
+}
+
+type dryState struct {
+	fields  map[string]interface{}
+	deleted bool
+}
+
+func (d *dryRun) add(c Change) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.changes = append(d.changes, c)
+}
+
+func (d *dryRun) lookup(uri string) (*dryState, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.states[uri]
+	if !ok {
+		return nil, false
+	}
+	return &dryState{fields: copyFields(s.fields), deleted: s.deleted}, true
+}
+
+func (d *dryRun) store(uri string, s *dryState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.states[uri] = s
+}
+
+func copyFields(fields map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		c[k] = v
+	}
+	return c
+}
+
+// readOnly reports whether the request changes nothing on Vagrant Cloud
+// despite its method, so it is sent even in dry-run mode:
+// creating a token from credentials, or validating one.
+func readOnly(method, uri string) bool {
+	return uri == "/authenticate" && (method == "POST" || method == "GET")
+}
+
+func dryInvalid(method, uri, field, msg string) error {
+	return &Error{
+		Msg:        "422 Unprocessable Entity",
+		StatusCode: http.StatusUnprocessableEntity,
+		Method:     method,
+		Path:       uri,
+		Errors:     map[string][]string{field: {msg}},
+	}
+}
+
+func dryNotFound(method, uri string) error {
+	return &Error{
+		Msg:        "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Method:     method,
+		Path:       uri,
+		Errors:     map[string][]string{"base": {"Resource not found!"}},
+	}
+}
+
+// get returns the resource at uri as Vagrant Cloud would after the recorded changes.
+func (d *dryRun) get(ctx context.Context, a *Api, uri string) ([]byte, error) {
+	fields, err := d.state(ctx, a, uri)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+func (d *dryRun) state(ctx context.Context, a *Api, uri string) (map[string]interface{}, error) {
+	s, ok := d.lookup(uri)
+	if ok && s.deleted {
+		return nil, dryNotFound("GET", uri)
+	}
+	var fields map[string]interface{}
+	if ok {
+		fields = s.fields
+	} else {
+		body, err := a.get(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+	}
+	d.mergeChildren(a, uri, fields)
+	return fields, nil
+}
+
+// mergeChildren applies the changed versions of a box, or providers of a version,
+// to its list of them.
+func (d *dryRun) mergeChildren(a *Api, uri string, fields map[string]interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, list := range []string{"versions", "providers"} {
+		items, _ := fields[list].([]interface{})
+		var merged []interface{}
+		seen := map[string]bool{}
+		for _, item := range items {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			child := childUri(a, uri, list, m)
+			seen[child] = true
+			if s, ok := d.states[child]; ok {
+				if s.deleted {
+					continue
+				}
+				m = s.fields
+			}
+			merged = append(merged, m)
+		}
+		for child, s := range d.states {
+			if p, l := parentUri(child); p != uri || l != list || seen[child] || s.deleted {
+				continue
+			}
+			merged = append(merged, s.fields)
+		}
+		if merged != nil || items != nil {
+			if merged == nil {
+				merged = []interface{}{}
+			}
+			fields[list] = merged
+		}
+	}
+}
+
+// childUri is the uri of a version or provider listed by the resource at uri.
+func childUri(a *Api, uri, list string, m map[string]interface{}) string {
+	if list == "versions" {
+		number, _ := m["number"].(string)
+		if number == "" {
+			number, _ = m["version"].(string)
+		}
+		return uri + "/version/" + number
+	}
+	name, _ := m["name"].(string)
+	child := uri + "/provider/" + name
+	if a.version == ApiV2 {
+		arch, _ := m["architecture"].(string)
+		child += "/" + string(v2Architecture(Architecture(arch)))
+	}
+	return child
+}
+
+// parentUri returns the resource listing the version or provider at uri, and the list.
+func parentUri(uri string) (string, string) {
+	if i := strings.LastIndex(uri, "/provider/"); i >= 0 {
+		return uri[:i], "providers"
+	}
+	if i := strings.LastIndex(uri, "/version/"); i >= 0 {
+		return uri[:i], "versions"
+	}
+	return "", ""
+}
+
+// record records a mutation and returns the intended state of the resource.
+func (d *dryRun) record(ctx context.Context, a *Api, method, uri string, params url.Values) ([]byte, error) {
+	if method == "POST" && uri == "/boxes" && params.Get("box[username]") == "" {
+		return nil, dryInvalid(method, uri, "username", "is required in a dry run")
+	}
+	c := Change{
+		Method: method,
+		Uri:    uri,
+		Params: url.Values{},
+	}
+	for k, v := range params {
+		c.Params[k] = append([]string(nil), v...)
+	}
+	d.add(c)
+	var target string
+	fields := map[string]interface{}{}
+	switch {
+	case method == "POST" && uri == "/boxes":
+		username, name := params.Get("box[username]"), params.Get("box[name]")
+		target = "/box/" + username + "/" + name
+		fields["tag"] = username + "/" + name
+		fields["versions"] = []interface{}{}
+	case method == "POST" && strings.HasSuffix(uri, "/versions"):
+		target = strings.TrimSuffix(uri, "/versions") + "/version/" + params.Get("version[version]")
+		fields["status"] = string(VersionUnreleased)
+		fields["providers"] = []interface{}{}
+	case method == "POST" && strings.HasSuffix(uri, "/providers"):
+		target = strings.TrimSuffix(uri, "/providers") + "/provider/" + params.Get("provider[name]")
+		if a.version == ApiV2 {
+			target += "/" + string(v2Architecture(Architecture(params.Get("provider[architecture]"))))
+		}
+		fields["hosted"] = params.Get("provider[url]") == ""
+	case method == "PUT" && (strings.HasSuffix(uri, "/release") || strings.HasSuffix(uri, "/revoke")):
+		i := strings.LastIndexByte(uri, '/')
+		target = uri[:i]
+		var err error
+		if fields, err = d.state(ctx, a, target); err != nil {
+			return nil, err
+		}
+		fields["status"] = string(VersionActive)
+		if uri[i:] == "/revoke" {
+			fields["status"] = string(VersionRevoked)
+		}
+	case method == "PUT" || method == "DELETE":
+		target = uri
+		var err error
+		if fields, err = d.state(ctx, a, target); err != nil {
+			return nil, err
+		}
+	default:
+		return []byte("{}"), nil
+	}
+	setFields(fields, params)
+	d.store(target, &dryState{
+		fields:  fields,
+		deleted: method == "DELETE",
+	})
+	return json.Marshal(fields)
+}
+
+// setFields copies form params such as box[description] to the json fields they set.
+func setFields(fields map[string]interface{}, params url.Values) {
+	for key := range params {
+		i := strings.IndexByte(key, '[')
+		if i < 0 || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		value := params.Get(key)
+		switch field := key[i+1 : len(key)-1]; field {
+		case "description":
+			fields["description_markdown"] = value
+		case "is_private":
+			fields["private"] = value == "true"
+		case "default_architecture":
+			fields[field] = value == "true"
+		case "url":
+			fields["original_url"] = value
+			fields["download_url"] = value
+		case "version":
+			fields["version"] = value
+			fields["number"] = value
+		default:
+			fields[field] = value
+		}
+	}
+}
+
+// recordUpload records the upload of a box file to the provider p.
+func (d *dryRun) recordUpload(ctx context.Context, p *Provider, fname string) error {
+	uri := p.Uri()
+	d.add(Change{
+		Method: "PUT",
+		Uri:    p.uploadUri(),
+		File:   fname,
+	})
+	fields, err := d.state(ctx, p.api, uri)
+	if err != nil {
+		return err
+	}
+	fields["hosted"] = true
+	d.store(uri, &dryState{fields: fields})
+	return nil
+}
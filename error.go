@@ -3,6 +3,11 @@ package vagrantcloud
 import (
 	"encoding/json"
 	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Standard HTTP response codes are returned.
@@ -17,25 +22,161 @@ import (
 // 				"has already been taken"
 // 			]
 // 		}
+//
+// Messages that do not belong to a field are collected under the "base" key.
 type Error struct {
-	Msg    string
-	Errors interface{}
+	Msg        string
+	StatusCode int
+	Method     string
+	Path       string
+	Errors     map[string][]string
+	// RetryAfter is the delay requested by the Retry-After header, if any.
+	RetryAfter time.Duration
+	retried    bool
 }
 
+// NewError builds an *Error from a response status line such as "404 Not Found"
+// and the response body.
 func NewError(msg string, errs string) error {
-	var info map[string]interface{}
-	err := json.Unmarshal([]byte(errs), &info)
-	if err == nil {
-		if errs, ok1 := info["errors"]; ok1 {
-			return &Error{
-				Msg:    msg,
-				Errors: errs,
+	e := &Error{
+		Msg: msg,
+	}
+	if i := strings.IndexByte(msg, ' '); i > 0 {
+		e.StatusCode, _ = strconv.Atoi(msg[:i])
+	} else {
+		e.StatusCode, _ = strconv.Atoi(msg)
+	}
+	e.parseErrors([]byte(errs))
+	return e
+}
+
+func newResponseError(resp *http.Response, body []byte) *Error {
+	e := &Error{
+		Msg:        resp.Status,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.Path = resp.Request.URL.Path
+	}
+	e.parseErrors(body)
+	return e
+}
+
+func (e *Error) parseErrors(body []byte) {
+	var info struct {
+		Errors json.RawMessage `json:"errors"`
+		Error  string          `json:"error"`
+	}
+	if json.Unmarshal(body, &info) != nil {
+		return
+	}
+	if info.Error != "" {
+		e.add("base", info.Error)
+	}
+	if len(info.Errors) == 0 {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(info.Errors, &fields) == nil {
+		for field, raw := range fields {
+			for _, msg := range parseMessages(raw) {
+				e.add(field, msg)
 			}
 		}
+		return
+	}
+	for _, msg := range parseMessages(info.Errors) {
+		e.add("base", msg)
 	}
-	return errors.New(msg)
+}
+
+func parseMessages(raw json.RawMessage) []string {
+	var msgs []string
+	if json.Unmarshal(raw, &msgs) == nil {
+		return msgs
+	}
+	var msg string
+	if json.Unmarshal(raw, &msg) == nil {
+		return []string{msg}
+	}
+	return nil
+}
+
+func (e *Error) add(field, msg string) {
+	if e.Errors == nil {
+		e.Errors = map[string][]string{}
+	}
+	e.Errors[field] = append(e.Errors[field], msg)
 }
 
 func (e *Error) Error() string {
-	return e.Msg
+	s := e.Msg
+	if e.Method != "" {
+		s = e.Method + " " + e.Path + ": " + s
+	}
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, msg := range e.Errors[field] {
+			if field == "base" {
+				s += "; " + msg
+			} else {
+				s += "; " + field + " " + msg
+			}
+		}
+	}
+	return s
+}
+
+// Taken reports whether the server rejected the request
+// because the resource already exists ("has already been taken").
+func (e *Error) Taken() bool {
+	for _, msgs := range e.Errors {
+		for _, msg := range msgs {
+			if strings.Contains(msg, "has already been taken") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func statusCode(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound reports whether err is a 404 Not Found response.
+// Vagrant Cloud also answers 404 for resources the token has no access to.
+func IsNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is a 401 Unauthorized response.
+func IsUnauthorized(err error) bool {
+	return statusCode(err) == http.StatusUnauthorized
+}
+
+// IsConflict reports whether err is a 409 Conflict response,
+// or a 422 validation failure because the resource already exists.
+func IsConflict(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	return e.StatusCode == http.StatusConflict ||
+		e.StatusCode == http.StatusUnprocessableEntity && e.Taken()
+}
+
+// IsRateLimited reports whether err is a 429 Too Many Requests response.
+func IsRateLimited(err error) bool {
+	return statusCode(err) == http.StatusTooManyRequests
 }
@@ -0,0 +1,107 @@
+package vagrantcloud
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits requests to rate per second on average,
+// allowing bursts of up to burst requests.
+// The limit is shared by every request made through the Api,
+// including retries, and is safe for concurrent use.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(a *Api) {
+		if rate > 0 {
+			a.limiter = newLimiter(rate, burst)
+		}
+	}
+}
+
+// WithMaxInFlight caps the number of requests in progress at the same time.
+func WithMaxInFlight(n int) Option {
+	return func(a *Api) {
+		if n > 0 {
+			a.inflight = make(chan struct{}, n)
+		}
+	}
+}
+
+// limiter is a token bucket refilled at rate tokens per second.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long to wait before it may be used.
+func (l *limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+func (l *limiter) cancel() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	d := l.reserve()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// acquire blocks until the request in ctx may be sent,
+// and returns a func that must be called once it has finished.
+func (a *Api) acquire(ctx context.Context) (func(), error) {
+	if a.limiter != nil {
+		if err := a.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if a.inflight == nil {
+		return func() {}, nil
+	}
+	select {
+	case a.inflight <- struct{}{}:
+		return func() { <-a.inflight }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,431 @@
+package vagrantcloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Manifest declares the boxes, versions and providers that should exist.
+// Api.Plan diffs it against Vagrant Cloud and Api.Apply makes it so.
+//
+//	{
+//		"boxes": [{
+//			"username": "yourname",
+//			"name": "boxname",
+//			"short_description": "Your box",
+//			"versions": [{
+//				"version": "1.0.0",
+//				"providers": [{"name": "virtualbox", "url": "http://your.box.url"}]
+//			}]
+//		}]
+//	}
+//
+// ParseManifest and LoadManifest read JSON; the package has no YAML dependency.
+// The fields carry yaml tags, so a YAML manifest is decoded with a YAML package
+// into a Manifest and passed to Plan, e.g. with gopkg.in/yaml.v3:
+//
+//	m := &vagrantcloud.Manifest{}
+//	err := yaml.Unmarshal(data, m)
+type Manifest struct {
+	Boxes []ManifestBox `json:"boxes" yaml:"boxes"`
+}
+
+type ManifestBox struct {
+	Username         string            `json:"username" yaml:"username"`
+	Name             string            `json:"name" yaml:"name"`
+	ShortDescription string            `json:"short_description" yaml:"short_description"`
+	Description      string            `json:"description" yaml:"description"`
+	Private          bool              `json:"private" yaml:"private"`
+	Versions         []ManifestVersion `json:"versions" yaml:"versions"`
+	// Prune deletes unreleased and revokes active versions missing from Versions.
+	Prune bool `json:"prune" yaml:"prune"`
+}
+
+type ManifestVersion struct {
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description" yaml:"description"`
+	// Status is active, the default, unreleased or revoked.
+	Status    VersionStatus      `json:"status" yaml:"status"`
+	Providers []ManifestProvider `json:"providers" yaml:"providers"`
+}
+
+// ManifestProvider is either self-hosted at Url,
+// or hosted by Vagrant Cloud and uploaded from File when it is created.
+type ManifestProvider struct {
+	Name                ProviderName `json:"name" yaml:"name"`
+	Architecture        Architecture `json:"architecture" yaml:"architecture"`
+	DefaultArchitecture bool         `json:"default_architecture" yaml:"default_architecture"`
+	Url                 string       `json:"url" yaml:"url"`
+	File                string       `json:"file" yaml:"file"`
+	Checksum            string       `json:"checksum" yaml:"checksum"`
+	ChecksumType        ChecksumType `json:"checksum_type" yaml:"checksum_type"`
+}
+
+// ParseManifest decodes a JSON manifest.
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadManifest reads a JSON manifest from the file fname.
+func LoadManifest(fname string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+type ActionKind string
+
+const (
+	ActionCreate  ActionKind = "create"
+	ActionUpdate  ActionKind = "update"
+	ActionDelete  ActionKind = "delete"
+	ActionRelease ActionKind = "release"
+	ActionRevoke  ActionKind = "revoke"
+)
+
+type ResourceKind string
+
+const (
+	ResourceBox      ResourceKind = "box"
+	ResourceVersion  ResourceKind = "version"
+	ResourceProvider ResourceKind = "provider"
+)
+
+// Action is one step of a Plan.
+// Deletes, releases and revokes may be built by hand;
+// creates and updates carry the manifest entry they apply and must come from Plan.
+type Action struct {
+	Kind         ActionKind
+	Resource     ResourceKind
+	Username     string
+	Name         string
+	Version      string
+	Provider     ProviderName
+	Architecture Architecture
+	// Changes names the fields changed by an update.
+	Changes []string
+
+	box      *ManifestBox
+	version  *ManifestVersion
+	provider *ManifestProvider
+}
+
+func (a Action) String() string {
+	s := string(a.Kind) + " " + string(a.Resource) + " " + a.Username + "/" + a.Name
+	if a.Version != "" {
+		s += " " + a.Version
+	}
+	if a.Provider != "" {
+		s += " " + string(a.Provider)
+		if a.Architecture != "" {
+			s += "/" + string(a.Architecture)
+		}
+	}
+	if len(a.Changes) > 0 {
+		s += " (" + strings.Join(a.Changes, ", ") + ")"
+	}
+	return s
+}
+
+// Plan lists the actions that bring Vagrant Cloud in line with a Manifest,
+// in the order Apply runs them.
+type Plan struct {
+	Actions []Action
+
+	// apiVersion is the version of the Api the plan was made for,
+	// which decides how providers without architecture are matched.
+	apiVersion ApiVersion
+}
+
+// ApplyError is returned by Api.Apply with the action that failed.
+// The actions before it have been applied.
+type ApplyError struct {
+	Action Action
+	Err    error
+}
+
+func (e *ApplyError) Error() string {
+	return "vagrantcloud: apply: " + e.Action.String() + ": " + e.Err.Error()
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// PLAN A MANIFEST
+//
+//	m (required)
+//		The desired boxes, versions and providers.
+//
+// Every box of the manifest is retrieved and compared with the manifest;
+// nothing is changed.
+func (a *Api) Plan(m *Manifest) (*Plan, error) {
+	return a.PlanContext(context.Background(), m)
+}
+
+func (a *Api) PlanContext(ctx context.Context, m *Manifest) (*Plan, error) {
+	plan := &Plan{apiVersion: a.version}
+	for n := range m.Boxes {
+		mb := &m.Boxes[n]
+		b := a.Box(mb.Username, mb.Name)
+		err := b.GetContext(ctx)
+		if IsNotFound(err) {
+			b = nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err := plan.box(mb, b); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func (plan *Plan) add(kind ActionKind, resource ResourceKind, mb *ManifestBox, mv *ManifestVersion, mp *ManifestProvider, changes ...string) {
+	action := Action{
+		Kind:     kind,
+		Resource: resource,
+		Username: mb.Username,
+		Name:     mb.Name,
+		Changes:  changes,
+		box:      mb,
+		version:  mv,
+		provider: mp,
+	}
+	if mv != nil {
+		action.Version = mv.Version
+	}
+	if mp != nil {
+		action.Provider = mp.Name
+		action.Architecture = mp.Architecture
+	}
+	plan.Actions = append(plan.Actions, action)
+}
+
+// box plans the box mb, whose live state is b, or nil if it does not exist yet.
+func (plan *Plan) box(mb *ManifestBox, b *Box) error {
+	if b == nil {
+		plan.add(ActionCreate, ResourceBox, mb, nil, nil)
+	} else {
+		var changes []string
+		if b.ShortDescription != mb.ShortDescription {
+			changes = append(changes, "short_description")
+		}
+		if b.DescriptionMarkdown != mb.Description {
+			changes = append(changes, "description")
+		}
+		if b.Private != mb.Private {
+			changes = append(changes, "private")
+		}
+		if len(changes) > 0 {
+			plan.add(ActionUpdate, ResourceBox, mb, nil, nil, changes...)
+		}
+	}
+	live := map[string]*Version{}
+	if b != nil {
+		for n := range b.Versions {
+			live[b.Versions[n].Version] = &b.Versions[n]
+		}
+	}
+	for n := range mb.Versions {
+		mv := &mb.Versions[n]
+		if err := plan.version(mb, mv, live[mv.Version]); err != nil {
+			return err
+		}
+		delete(live, mv.Version)
+	}
+	if !mb.Prune || b == nil {
+		return nil
+	}
+	for n := range b.Versions {
+		v := &b.Versions[n]
+		if _, ok := live[v.Version]; !ok {
+			continue
+		}
+		mv := &ManifestVersion{Version: v.Version}
+		switch v.Status {
+		case VersionUnreleased:
+			plan.add(ActionDelete, ResourceVersion, mb, mv, nil)
+		case VersionActive:
+			plan.add(ActionRevoke, ResourceVersion, mb, mv, nil)
+		}
+	}
+	return nil
+}
+
+func (plan *Plan) version(mb *ManifestBox, mv *ManifestVersion, v *Version) error {
+	want := mv.Status
+	if want == "" {
+		want = VersionActive
+	}
+	status := VersionUnreleased
+	if v == nil {
+		plan.add(ActionCreate, ResourceVersion, mb, mv, nil)
+	} else {
+		status = v.Status
+		if v.DescriptionMarkdown != mv.Description {
+			plan.add(ActionUpdate, ResourceVersion, mb, mv, nil, "description")
+		}
+	}
+	live := map[string]*Provider{}
+	if v != nil {
+		for n := range v.Providers {
+			p := &v.Providers[n]
+			live[plan.providerKey(p.Name, p.Architecture)] = p
+		}
+	}
+	for n := range mv.Providers {
+		mp := &mv.Providers[n]
+		key := plan.providerKey(mp.Name, mp.Architecture)
+		p, ok := live[key]
+		delete(live, key)
+		if !ok {
+			plan.add(ActionCreate, ResourceProvider, mb, mv, mp)
+			continue
+		}
+		var changes []string
+		if mp.Url != "" && p.OriginalUrl != mp.Url {
+			changes = append(changes, "url")
+		}
+		if mp.Checksum != "" && (p.Checksum != mp.Checksum || p.ChecksumType != mp.ChecksumType) {
+			changes = append(changes, "checksum")
+		}
+		if mp.Architecture != "" && p.DefaultArchitecture != mp.DefaultArchitecture {
+			changes = append(changes, "default_architecture")
+		}
+		if len(changes) > 0 {
+			plan.add(ActionUpdate, ResourceProvider, mb, mv, mp, changes...)
+		}
+	}
+	if v != nil {
+		for n := range v.Providers {
+			p := &v.Providers[n]
+			if _, ok := live[plan.providerKey(p.Name, p.Architecture)]; ok {
+				plan.add(ActionDelete, ResourceProvider, mb, mv, &ManifestProvider{Name: p.Name, Architecture: p.Architecture})
+			}
+		}
+	}
+	switch {
+	case status == want:
+	case status == VersionUnreleased && want == VersionActive:
+		plan.add(ActionRelease, ResourceVersion, mb, mv, nil)
+	case status == VersionUnreleased && want == VersionRevoked:
+		plan.add(ActionRelease, ResourceVersion, mb, mv, nil)
+		plan.add(ActionRevoke, ResourceVersion, mb, mv, nil)
+	case status == VersionActive && want == VersionRevoked:
+		plan.add(ActionRevoke, ResourceVersion, mb, mv, nil)
+	default:
+		return fmt.Errorf("vagrantcloud: plan: version %s/%s %s is %s and cannot become %s",
+			mb.Username, mb.Name, mv.Version, status, want)
+	}
+	return nil
+}
+
+// providerKey identifies a provider of a version.
+// Under v2 a provider without architecture is listed as unknown.
+func (plan *Plan) providerKey(name ProviderName, arch Architecture) string {
+	if plan.apiVersion == ApiV2 {
+		arch = v2Architecture(arch)
+	}
+	return providerKey(name, arch)
+}
+
+func providerKey(name ProviderName, arch Architecture) string {
+	return string(name) + "/" + string(arch)
+}
+
+// APPLY A PLAN
+//
+//	plan (required)
+//		The actions returned by Plan.
+//
+// The actions are run in order; the first failure stops Apply
+// and is returned as an *ApplyError.
+func (a *Api) Apply(plan *Plan) error {
+	return a.ApplyContext(context.Background(), plan)
+}
+
+func (a *Api) ApplyContext(ctx context.Context, plan *Plan) error {
+	for _, action := range plan.Actions {
+		if err := a.apply(ctx, action); err != nil {
+			return &ApplyError{Action: action, Err: err}
+		}
+	}
+	return nil
+}
+
+func (a *Api) apply(ctx context.Context, action Action) error {
+	mb, mv, mp := action.box, action.version, action.provider
+	if action.Kind == ActionCreate || action.Kind == ActionUpdate {
+		// the desired fields are only known to actions returned by Plan
+		if mb == nil || action.Resource != ResourceBox && mv == nil || action.Resource == ResourceProvider && mp == nil {
+			return errors.New("no manifest entry to " + string(action.Kind) + " from, the action was not returned by Plan")
+		}
+	}
+	b := a.Box(action.Username, action.Name)
+	if action.Resource == ResourceBox {
+		if action.Kind != ActionCreate && action.Kind != ActionUpdate {
+			return fmt.Errorf("unknown action %s", action.Kind)
+		}
+		b.ShortDescription = mb.ShortDescription
+		b.DescriptionMarkdown = mb.Description
+		b.Private = mb.Private
+		if action.Kind == ActionCreate {
+			return b.NewContext(ctx)
+		}
+		return b.SetContext(ctx)
+	}
+	v := b.Version(action.Version)
+	v.Version = action.Version
+	if mv != nil {
+		v.DescriptionMarkdown = mv.Description
+	}
+	if action.Resource == ResourceVersion {
+		switch action.Kind {
+		case ActionCreate:
+			return v.NewContext(ctx)
+		case ActionUpdate:
+			return v.SetContext(ctx)
+		case ActionDelete:
+			return v.DeleteContext(ctx)
+		case ActionRelease:
+			return v.ReleaseContext(ctx)
+		case ActionRevoke:
+			return v.RevokeContext(ctx)
+		}
+		return fmt.Errorf("unknown action %s", action.Kind)
+	}
+	p := v.Provider(action.Provider)
+	p.Architecture = action.Architecture
+	if mp != nil {
+		p.DefaultArchitecture = mp.DefaultArchitecture
+		p.OriginalUrl = mp.Url
+		p.Checksum = mp.Checksum
+		p.ChecksumType = mp.ChecksumType
+	}
+	switch action.Kind {
+	case ActionCreate:
+		if err := p.NewContext(ctx); err != nil {
+			return err
+		}
+		if mp.File == "" {
+			return nil
+		}
+		return p.UploadFileContext(ctx, mp.File, nil)
+	case ActionUpdate:
+		return p.SetContext(ctx)
+	case ActionDelete:
+		return p.DeleteContext(ctx)
+	}
+	return fmt.Errorf("unknown action %s", action.Kind)
+}
@@ -1,9 +1,16 @@
 package vagrantcloud
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"hash"
 	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"time"
 )
 
@@ -18,23 +25,38 @@ const (
 	ProviderHyperv        ProviderName = "hyperv"
 )
 
+type Architecture string
+
+const (
+	ArchitectureAmd64   Architecture = "amd64"
+	ArchitectureI386    Architecture = "i386"
+	ArchitectureArm64   Architecture = "arm64"
+	ArchitectureArm     Architecture = "arm"
+	ArchitectureUnknown Architecture = "unknown"
+)
+
 // Providers contain the pointers to the box files,
 // be it a hosted or self-hosted box.
 // Versions can have many providers,
 // each which represents a Vagrant compatible provider,
 // either from Vagrant Core as a 3rd party plugin.
 type Provider struct {
-	api         *Api
-	box         *Box
-	version     *Version
-	Name        ProviderName `json:"name"`
-	Hosted      bool         `json:"hosted"`
-	HostedToken string       `json:"hosted_token"`
-	OriginalUrl string       `json:"original_url"`
-	UploadUrl   string       `json:"upload_url"`
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
-	DownloadUrl string       `json:"download_url"`
+	api          *Api
+	box          *Box
+	version      *Version
+	Name         ProviderName `json:"name"`
+	Hosted       bool         `json:"hosted"`
+	HostedToken  string       `json:"hosted_token"`
+	OriginalUrl  string       `json:"original_url"`
+	UploadUrl    string       `json:"upload_url"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	DownloadUrl  string       `json:"download_url"`
+	Checksum     string       `json:"checksum"`
+	ChecksumType ChecksumType `json:"checksum_type"`
+
+	Architecture        Architecture `json:"architecture"`
+	DefaultArchitecture bool         `json:"default_architecture"`
 }
 
 func (v *Version) Provider(name ProviderName) *Provider {
@@ -61,7 +83,20 @@ func (p *Provider) parseBody(body []byte) error {
 }
 
 func (p *Provider) Uri() string {
-	return p.version.Uri() + "/provider/" + string(p.Name)
+	uri := p.version.Uri() + "/provider/" + string(p.Name)
+	if p.api.version == ApiV2 {
+		uri += "/" + string(v2Architecture(p.Architecture))
+	}
+	return uri
+}
+
+// uploadUri returns the endpoint handing out the upload path:
+// a direct upload with a callback under v2, or one confirmed by token under v1.
+func (p *Provider) uploadUri() string {
+	if p.api.version == ApiV2 {
+		return p.Uri() + "/upload/direct"
+	}
+	return p.Uri() + "/upload"
 }
 
 // RETRIEVE A PROVIDER
@@ -70,7 +105,11 @@ func (p *Provider) Uri() string {
 //		The name of the provider. Vagrant will use this to determine compatible boxes on the client.
 //		Common providers include virtualbox, vmware_desktop, digitalocean, aws, rackspace, and hyperv.
 func (p *Provider) Get() error {
-	body, err := p.api.Get(p.Uri())
+	return p.GetContext(context.Background())
+}
+
+func (p *Provider) GetContext(ctx context.Context) error {
+	body, err := p.api.GetContext(ctx, p.Uri())
 	if err != nil {
 		return err
 	}
@@ -86,21 +125,44 @@ func (p *Provider) Get() error {
 //		An HTTP URL to the box file.
 //		This must be accessible at this URL from the machine where you expect a user to download the box by using Vagrant.
 //		If ommitted, we assume you wish to host the provider with Vagrant Cloud.
+//	Checksum
+//		Checksum of the box file, used by Vagrant to verify the download.
+//	ChecksumType
+//		Type of the Checksum: md5, sha1, sha256, sha384 or sha512.
+//	Architecture
+//		The architecture of the box, e.g. amd64 or arm64.
+//	DefaultArchitecture
+//		A boolean if this architecture is used when the host architecture has no match.
 //
 // The provider API is used to host boxes.
 // To create a hosted box, simply omit the URL parameter.
 // You will then be able to use the upload endpoint to upload a box to us.
 func (p *Provider) New() error {
+	return p.NewContext(context.Background())
+}
+
+func (p *Provider) NewContext(ctx context.Context) error {
+	_, err := p.create(ctx)
+	return err
+}
+
+// create is NewContext, reporting whether the provider was recovered
+// after a retried POST found it taken, i.e. it may have existed before.
+func (p *Provider) create(ctx context.Context) (bool, error) {
 	params := url.Values{}
 	params.Add("provider[name]", string(p.Name))
 	if p.OriginalUrl != "" {
 		params.Add("provider[url]", p.OriginalUrl)
 	}
-	body, err := p.api.Post(p.version.Uri()+"/providers", params)
+	p.addParams(params)
+	body, err := p.api.PostContext(ctx, p.version.Uri()+"/providers", params)
 	if err != nil {
-		return err
+		if createdByRetry(err) {
+			return true, p.GetContext(ctx)
+		}
+		return false, err
 	}
-	return p.parseBody(body)
+	return false, p.parseBody(body)
 }
 
 // UPDATE A PROVIDER
@@ -112,23 +174,66 @@ func (p *Provider) New() error {
 //		An HTTP URL to the box file.
 //		This must be accessible at this URL from the machine where you expect a user to download the box by using Vagrant.
 //		If ommitted, we assume you wish to host the provider with Vagrant Cloud.
+//	Checksum
+//		Checksum of the box file, used by Vagrant to verify the download.
+//	ChecksumType
+//		Type of the Checksum: md5, sha1, sha256, sha384 or sha512.
+//	Architecture
+//		The architecture of the box, e.g. amd64 or arm64.
+//	DefaultArchitecture
+//		A boolean if this architecture is used when the host architecture has no match.
 func (p *Provider) Set() error {
+	return p.SetContext(context.Background())
+}
+
+func (p *Provider) SetContext(ctx context.Context) error {
 	params := url.Values{}
 	params.Add("provider[url]", p.OriginalUrl)
-	body, err := p.api.Put(p.Uri(), params)
+	p.addParams(params)
+	body, err := p.api.PutContext(ctx, p.Uri(), params)
 	if err != nil {
 		return err
 	}
 	return p.parseBody(body)
 }
 
+func (p *Provider) addParams(params url.Values) {
+	if p.Checksum != "" {
+		params.Add("provider[checksum]", p.Checksum)
+		params.Add("provider[checksum_type]", string(p.ChecksumType))
+	}
+	if p.api.version == ApiV2 {
+		params.Add("provider[architecture]", string(v2Architecture(p.Architecture)))
+		params.Add("provider[default_architecture]", strconv.FormatBool(p.DefaultArchitecture))
+	} else if p.Architecture != "" {
+		params.Add("provider[architecture]", string(p.Architecture))
+		params.Add("provider[default_architecture]", strconv.FormatBool(p.DefaultArchitecture))
+	}
+}
+
+// ChecksumFile sets Checksum and ChecksumType from the local box file fname.
+// Call Set to save them.
+func (p *Provider) ChecksumFile(fname string, t ChecksumType) error {
+	sum, err := FileChecksum(fname, t)
+	if err != nil {
+		return err
+	}
+	p.Checksum = sum
+	p.ChecksumType = t
+	return nil
+}
+
 // DESTROY A PROVIDER
 //
 //	Name (required)
 //		The name of the provider. Vagrant will use this to determine compatible boxes on the client.
 //		Common providers include virtualbox, vmware_desktop, digitalocean, aws, rackspace, and hyperv.
 func (p *Provider) Delete() error {
-	body, err := p.api.Delete(p.Uri())
+	return p.DeleteContext(context.Background())
+}
+
+func (p *Provider) DeleteContext(ctx context.Context) error {
+	body, err := p.api.DeleteContext(ctx, p.Uri())
 	if err != nil {
 		return err
 	}
@@ -146,12 +251,154 @@ func (p *Provider) Delete() error {
 // After streaming the box,
 // you can confirm the upload by comparing the token provided in the UPLOAD response with the token returned from the providers GET route.
 // When these tokens match, the upload has been successful.
+//
+// Upload runs all three steps and polls the provider until the tokens match,
+// returning a *HostedTokenError if they still differ after the upload timeout.
 func (p *Provider) Upload(data io.Reader) error {
-	body, err := p.api.Upload(p.Uri()+"/upload", data)
+	return p.UploadContext(context.Background(), data)
+}
+
+func (p *Provider) UploadContext(ctx context.Context, data io.Reader) error {
+	if p.api.dryRun != nil {
+		return p.dryUploadFile(ctx, "", nil)
+	}
+	path, err := p.uploadPath(ctx)
 	if err != nil {
 		return err
 	}
-	return p.parseBody(body)
+	if _, err := p.api.putUrl(ctx, path.url, data); err != nil {
+		return err
+	}
+	return p.finishUpload(ctx, path)
+}
+
+// UPLOAD A .BOX FILE FOR PROVIDER
+//
+//	Name (required)
+//		The name of the provider. Vagrant will use this to determine compatible boxes on the client.
+//		Common providers include virtualbox, vmware_desktop, digitalocean, aws, rackspace, and hyperv.
+//	fname (string, required)
+//		Path of the .box file.
+//	progress (Progress)
+//		Called with the bytes sent so far, may be nil.
+//
+// Unlike Upload, the Content-Length is sent with the box,
+// and a failed transfer is resumed where the server allows it or retried from the start.
+// If ChecksumType is set without a Checksum,
+// the checksum is computed while uploading and saved to the provider afterwards.
+func (p *Provider) UploadFile(fname string, progress Progress) error {
+	return p.UploadFileContext(context.Background(), fname, progress)
+}
+
+func (p *Provider) UploadFileContext(ctx context.Context, fname string, progress Progress) error {
+	var h hash.Hash
+	t := p.ChecksumType
+	if t != "" && p.Checksum == "" {
+		var err error
+		if h, err = t.NewHash(); err != nil {
+			return err
+		}
+	}
+	if p.api.dryRun != nil {
+		return p.dryUploadFile(ctx, fname, h)
+	}
+	path, err := p.uploadPath(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := p.api.uploadFile(ctx, path.url, fname, progress, h); err != nil {
+		return p.api.redact(err)
+	}
+	if err := p.finishUpload(ctx, path); err != nil {
+		return err
+	}
+	if h == nil {
+		return nil
+	}
+	p.Checksum = hex.EncodeToString(h.Sum(nil))
+	p.ChecksumType = t
+	return p.SetContext(ctx)
+}
+
+// dryUploadFile records the upload of fname in dry-run mode,
+// saving the checksum if h is set, as UploadFile would.
+func (p *Provider) dryUploadFile(ctx context.Context, fname string, h hash.Hash) error {
+	if err := p.api.dryRun.recordUpload(ctx, p, fname); err != nil {
+		return err
+	}
+	if h == nil {
+		return p.GetContext(ctx)
+	}
+	if err := p.ChecksumFile(fname, p.ChecksumType); err != nil {
+		return err
+	}
+	return p.SetContext(ctx)
+}
+
+type uploadPath struct {
+	url      string
+	token    string
+	callback string
+}
+
+func (p *Provider) uploadPath(ctx context.Context) (*uploadPath, error) {
+	body, err := p.api.GetContext(ctx, p.uploadUri())
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		UploadPath string `json:"upload_path"`
+		Token      string `json:"token"`
+		Callback   string `json:"callback"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, err
+	}
+	path := &uploadPath{
+		token: info.Token,
+	}
+	if path.url, err = p.api.uploadUrl(info.UploadPath); err != nil {
+		return nil, err
+	}
+	if info.Callback != "" {
+		if path.callback, err = p.api.uploadUrl(info.Callback); err != nil {
+			return nil, err
+		}
+	}
+	return path, nil
+}
+
+// finishUpload calls the upload callback of the v2 API, if any,
+// and waits for the upload to be confirmed.
+func (p *Provider) finishUpload(ctx context.Context, path *uploadPath) error {
+	if path.callback != "" {
+		if _, err := p.api.putUrl(ctx, path.callback, http.NoBody); err != nil {
+			return err
+		}
+	}
+	return p.verify(ctx, path.token)
+}
+
+// verify polls the provider until its HostedToken matches token.
+func (p *Provider) verify(ctx context.Context, token string) error {
+	deadline := time.Now().Add(p.api.uploadTimeout)
+	for {
+		if err := p.GetContext(ctx); err != nil {
+			return err
+		}
+		if token == "" || p.HostedToken == token {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return &HostedTokenError{
+				Want: token,
+				Got:  p.HostedToken,
+			}
+		}
+		if err := sleep(ctx, verifyInterval); err != nil {
+			return err
+		}
+	}
 }
 
 // DOWNLOAD A .BOX FOR PROVIDER
@@ -160,9 +407,52 @@ func (p *Provider) Upload(data io.Reader) error {
 //		The name of the provider. Vagrant will use this to determine compatible boxes on the client.
 //		Common providers include virtualbox, vmware_desktop, digitalocean, aws, rackspace, and hyperv.
 func (p *Provider) Download(data io.Writer) error {
-	err := p.api.Download("/"+p.box.Username+"/"+p.box.Name+"/version/"+p.version.Number+"/provider/"+string(p.Name)+".box", data)
-	if err != nil {
+	return p.DownloadContext(context.Background(), data)
+}
+
+func (p *Provider) DownloadContext(ctx context.Context, data io.Writer) error {
+	return p.api.DownloadContext(ctx, p.downloadUri(), data)
+}
+
+// DOWNLOAD A .BOX FILE FOR PROVIDER
+//
+//	Name (required)
+//		The name of the provider. Vagrant will use this to determine compatible boxes on the client.
+//		Common providers include virtualbox, vmware_desktop, digitalocean, aws, rackspace, and hyperv.
+//	fname (string, required)
+//		Path to save the .box file to.
+//	progress (Progress)
+//		Called with the bytes received so far, may be nil.
+//
+// An interrupted download is resumed from fname + ".part".
+// When the provider has a Checksum of a known ChecksumType,
+// the file is verified before it is renamed to fname;
+// on a mismatch a *ChecksumError is returned and the partial file is removed.
+func (p *Provider) DownloadFile(fname string, progress Progress) error {
+	return p.DownloadFileContext(context.Background(), fname, progress)
+}
+
+func (p *Provider) DownloadFileContext(ctx context.Context, fname string, progress Progress) error {
+	part := fname + ".part"
+	if err := p.api.downloadFile(ctx, p.downloadUri(), part, progress); err != nil {
 		return err
 	}
-	return nil
+	if _, err := p.ChecksumType.NewHash(); p.Checksum != "" && err == nil {
+		if err := VerifyChecksum(part, p.ChecksumType, p.Checksum); err != nil {
+			var e *ChecksumError
+			if errors.As(err, &e) {
+				os.Remove(part)
+			}
+			return err
+		}
+	}
+	return os.Rename(part, fname)
+}
+
+func (p *Provider) downloadUri() string {
+	if p.api.version == ApiV2 {
+		return "/" + p.box.Username + "/boxes/" + p.box.Name + "/versions/" + p.version.Number +
+			"/providers/" + string(p.Name) + "/" + string(v2Architecture(p.Architecture)) + "/vagrant.box"
+	}
+	return "/" + p.box.Username + "/" + p.box.Name + "/version/" + p.version.Number + "/provider/" + string(p.Name) + ".box"
 }
@@ -0,0 +1,176 @@
+package vagrantcloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// PublishSpec describes a version to publish with Box.Publish.
+type PublishSpec struct {
+	Version     string
+	Description string
+	Providers   []PublishProvider
+}
+
+// PublishProvider describes a provider of a published version.
+// Exactly one of Url, for a self-hosted box, or File, for a box to upload, must be set.
+type PublishProvider struct {
+	Name                ProviderName
+	Architecture        Architecture
+	DefaultArchitecture bool
+	Url                 string
+	File                string
+	// Checksum and ChecksumType are saved with the provider.
+	// For a File, setting only ChecksumType computes the checksum while uploading.
+	Checksum     string
+	ChecksumType ChecksumType
+	// Progress reports the upload of File, may be nil.
+	Progress Progress
+}
+
+// PublishError is returned by Box.Publish with the step that failed.
+// Whatever Publish created was deleted again,
+// unless that failed too, which is reported in Rollback.
+type PublishError struct {
+	Step     string
+	Err      error
+	Rollback []error
+}
+
+func (e *PublishError) Error() string {
+	s := "vagrantcloud: publish: " + e.Step + ": " + e.Err.Error()
+	if len(e.Rollback) > 0 {
+		s += fmt.Sprintf(" (rollback failed: %v)", e.Rollback)
+	}
+	return s
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// PUBLISH A VERSION
+//
+//	spec (required)
+//		The version, its description and its providers.
+//
+// Publish creates the version and its providers, uploads the box files,
+// checks that every provider is in place and then releases the version.
+// If any step fails, the providers and the version created so far are deleted
+// and a *PublishError naming the step is returned.
+// A version or provider found to exist already when a retried request
+// reports it as taken is left in place.
+func (b *Box) Publish(spec PublishSpec) (*Version, error) {
+	return b.PublishContext(context.Background(), spec)
+}
+
+func (b *Box) PublishContext(ctx context.Context, spec PublishSpec) (*Version, error) {
+	if err := spec.validate(); err != nil {
+		return nil, &PublishError{Step: "validate", Err: err}
+	}
+	v := b.Version(spec.Version)
+	v.Version = spec.Version
+	v.DescriptionMarkdown = spec.Description
+	existed, err := v.create(ctx)
+	if err != nil {
+		return nil, &PublishError{Step: "create version " + spec.Version, Err: err}
+	}
+	var created []*Provider
+	fail := func(step string, err error) (*Version, error) {
+		e := &PublishError{Step: step, Err: err}
+		// roll back even if ctx was cancelled
+		rctx := context.WithoutCancel(ctx)
+		for n := len(created) - 1; n >= 0; n-- {
+			if err := created[n].DeleteContext(rctx); err != nil {
+				e.Rollback = append(e.Rollback, err)
+			}
+		}
+		if existed {
+			return nil, e
+		}
+		if err := v.DeleteContext(rctx); err != nil {
+			e.Rollback = append(e.Rollback, err)
+		}
+		return nil, e
+	}
+	for _, sp := range spec.Providers {
+		p := v.Provider(sp.Name)
+		p.Architecture = sp.Architecture
+		p.DefaultArchitecture = sp.DefaultArchitecture
+		p.OriginalUrl = sp.Url
+		p.Checksum = sp.Checksum
+		p.ChecksumType = sp.ChecksumType
+		existed, err := p.create(ctx)
+		if err != nil {
+			return fail("create provider "+sp.String(), err)
+		}
+		if !existed {
+			created = append(created, p)
+		}
+		if sp.File == "" {
+			continue
+		}
+		// a checksum computed while uploading is saved by UploadFile
+		if err := p.UploadFileContext(ctx, sp.File, sp.Progress); err != nil {
+			return fail("upload provider "+sp.String(), err)
+		}
+	}
+	if err := v.GetContext(ctx); err != nil {
+		return fail("verify version "+spec.Version, err)
+	}
+	for _, sp := range spec.Providers {
+		if err := sp.verify(v); err != nil {
+			return fail("verify provider "+sp.String(), err)
+		}
+	}
+	if err := v.ReleaseContext(ctx); err != nil {
+		return fail("release version "+spec.Version, err)
+	}
+	return v, nil
+}
+
+func (spec *PublishSpec) validate() error {
+	if spec.Version == "" {
+		return errors.New("version is required")
+	}
+	if _, err := ParseSemVer(spec.Version); err != nil {
+		return err
+	}
+	if len(spec.Providers) == 0 {
+		return errors.New("at least one provider is required")
+	}
+	for _, sp := range spec.Providers {
+		if sp.Name == "" {
+			return errors.New("provider name is required")
+		}
+		if (sp.Url == "") == (sp.File == "") {
+			return errors.New("provider " + sp.String() + " needs either a url or a file")
+		}
+	}
+	return nil
+}
+
+func (sp *PublishProvider) String() string {
+	if sp.Architecture != "" {
+		return string(sp.Name) + "/" + string(sp.Architecture)
+	}
+	return string(sp.Name)
+}
+
+// verify checks that the provider is listed by v and points at its box.
+func (sp *PublishProvider) verify(v *Version) error {
+	for _, p := range v.Providers {
+		if p.Name != sp.Name || sp.Architecture != "" && p.Architecture != sp.Architecture {
+			continue
+		}
+		if sp.File != "" && !p.Hosted {
+			return errors.New("box was not uploaded")
+		}
+		if sp.Url != "" && p.OriginalUrl != sp.Url {
+			return errors.New("url is " + p.OriginalUrl)
+		}
+		return nil
+	}
+	return errors.New("provider is missing")
+}
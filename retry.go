@@ -0,0 +1,146 @@
+package vagrantcloud
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how transient failures are retried:
+// 429 Too Many Requests, 502, 503 and 504 responses and network errors.
+//
+// GET, PUT and DELETE requests are retried automatically.
+// POST requests create resources and are only retried when RetryPost is set;
+// a create that fails with "has already been taken" after a retry
+// is treated as successful and the resource is fetched again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. Defaults to 3.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry. Defaults to 500ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the exponential backoff and any Retry-After delay. Defaults to 30s.
+	MaxBackoff time.Duration
+	// RetryPost enables retrying POST requests.
+	RetryPost bool
+}
+
+// WithRetry enables retrying transient failures according to p.
+func WithRetry(p RetryPolicy) Option {
+	return func(a *Api) {
+		a.retry = p.withDefaults()
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = 500 * time.Millisecond
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = 30 * time.Second
+	}
+	return p
+}
+
+func (p *RetryPolicy) retryable(req *http.Request, attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts || req.Context().Err() != nil {
+		return false
+	}
+	if req.Method == "POST" && !p.RetryPost {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	return transient(err)
+}
+
+// transient reports whether err is a network error or a response
+// that is worth retrying later.
+func transient(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (p *RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var e *Error
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		if e.RetryAfter > p.MaxBackoff {
+			return p.MaxBackoff
+		}
+		return e.RetryAfter
+	}
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (a *Api) doRetry(req *http.Request) ([]byte, error) {
+	body, err := a.send(req)
+	for attempt := 1; a.retry.retryable(req, attempt, err); attempt++ {
+		if err := sleep(req.Context(), a.retry.backoff(attempt, err)); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		body, err = a.send(req)
+		var e *Error
+		if errors.As(err, &e) {
+			e.retried = true
+		}
+	}
+	return body, err
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// createdByRetry reports whether err is a "has already been taken" failure
+// of a POST that was retried, i.e. an earlier attempt probably succeeded.
+func createdByRetry(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.retried &&
+		e.StatusCode == http.StatusUnprocessableEntity && e.Taken()
+}
+
+func parseRetryAfter(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
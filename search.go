@@ -0,0 +1,193 @@
+package vagrantcloud
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+type SearchSort string
+
+const (
+	SortDownloads SearchSort = "downloads"
+	SortCreated   SearchSort = "created"
+	SortUpdated   SearchSort = "updated"
+)
+
+type SearchOrder string
+
+const (
+	OrderDesc SearchOrder = "desc"
+	OrderAsc  SearchOrder = "asc"
+)
+
+// searchLimit is the page size used when SearchOptions.Limit is not set.
+const searchLimit = 25
+
+// SearchOptions narrow down and order the boxes returned by a search.
+// The zero value returns every box in the server's default order.
+type SearchOptions struct {
+	// Provider only returns boxes with a provider of this name.
+	Provider ProviderName
+	// Sort is one of downloads, created or updated.
+	Sort SearchSort
+	// Order is desc or asc.
+	Order SearchOrder
+	// Page is the first page to return, starting at 1.
+	Page int
+	// Limit is the number of boxes fetched per page.
+	Limit int
+}
+
+func (o *SearchOptions) params() url.Values {
+	params := url.Values{}
+	if o == nil {
+		return params
+	}
+	if o.Provider != "" {
+		params.Set("provider", string(o.Provider))
+	}
+	if o.Sort != "" {
+		params.Set("sort", string(o.Sort))
+	}
+	if o.Order != "" {
+		params.Set("order", string(o.Order))
+	}
+	return params
+}
+
+// BoxIterator pages through the boxes of a search transparently:
+//
+//	it := api.Search("ubuntu", nil)
+//	for it.Next() {
+//		box := it.Box()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type BoxIterator struct {
+	api    *Api
+	ctx    context.Context
+	uri    string
+	params url.Values
+	page   int
+	limit  int
+	boxes  []Box
+	box    *Box
+	done   bool
+	err    error
+}
+
+func (a *Api) newBoxIterator(ctx context.Context, uri string, params url.Values, opts *SearchOptions) *BoxIterator {
+	it := &BoxIterator{
+		api:    a,
+		ctx:    ctx,
+		uri:    uri,
+		params: params,
+		page:   1,
+		limit:  searchLimit,
+	}
+	if opts != nil && opts.Page > 0 {
+		it.page = opts.Page
+	}
+	if opts != nil && opts.Limit > 0 {
+		it.limit = opts.Limit
+	}
+	return it
+}
+
+// Next advances to the next box, fetching the next page when needed.
+// It returns false at the end of the results or on error.
+func (it *BoxIterator) Next() bool {
+	for len(it.boxes) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.box = &it.boxes[0]
+	it.boxes = it.boxes[1:]
+	return true
+}
+
+func (it *BoxIterator) fetch() {
+	it.params.Set("page", strconv.Itoa(it.page))
+	it.params.Set("limit", strconv.Itoa(it.limit))
+	body, err := it.api.GetContext(it.ctx, it.uri+"?"+it.params.Encode())
+	if err != nil {
+		it.err = err
+		return
+	}
+	var result struct {
+		Boxes []Box `json:"boxes"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		it.err = err
+		return
+	}
+	for n := range result.Boxes {
+		(&result.Boxes[n]).init(it.api)
+	}
+	it.boxes = result.Boxes
+	// a page may be short of the limit before the end, only an empty one is last
+	it.done = len(result.Boxes) == 0
+	it.page++
+}
+
+// Box returns the current box.
+func (it *BoxIterator) Box() *Box {
+	return it.box
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *BoxIterator) Err() error {
+	return it.err
+}
+
+// SEARCH BOXES
+//
+//	query
+//		The search query. Results will match the username, name, or short_description fields for a box.
+//		If omitted, the top boxes based on sort and order will be returned (defaults to "downloads desc").
+//	opts (*SearchOptions)
+//		Provider filter, sort, order and paging, may be nil.
+func (a *Api) Search(query string, opts *SearchOptions) *BoxIterator {
+	return a.SearchContext(context.Background(), query, opts)
+}
+
+func (a *Api) SearchContext(ctx context.Context, query string, opts *SearchOptions) *BoxIterator {
+	params := opts.params()
+	if query != "" {
+		params.Set("q", query)
+	}
+	return a.newBoxIterator(ctx, "/search", params, opts)
+}
+
+// LIST BOXES OF A USER
+//
+//	username (required)
+//		The user whose boxes are listed, including private boxes the token has access to.
+func (a *Api) UserBoxes(username string) *BoxIterator {
+	return a.UserBoxesContext(context.Background(), username)
+}
+
+func (a *Api) UserBoxesContext(ctx context.Context, username string) *BoxIterator {
+	return a.newBoxIterator(ctx, "/user/"+username+"/search", url.Values{}, nil)
+}
+
+// LIST BOXES OF AN ORGANIZATION
+//
+//	org (required)
+//		The organization whose boxes are listed.
+//
+// Organizations share the username namespace with users,
+// so this lists the same boxes as UserBoxes(org).
+func (a *Api) OrganizationBoxes(org string) *BoxIterator {
+	return a.OrganizationBoxesContext(context.Background(), org)
+}
+
+func (a *Api) OrganizationBoxesContext(ctx context.Context, org string) *BoxIterator {
+	return a.UserBoxesContext(ctx, org)
+}
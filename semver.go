@@ -0,0 +1,288 @@
+package vagrantcloud
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoMatchingVersion is returned by Box.ResolveVersion
+// when no active version satisfies the constraint.
+var ErrNoMatchingVersion = errors.New("vagrantcloud: no matching version")
+
+// SemVer is a parsed semantic version, such as 1.2.3 or 1.0.0-beta.1+build.5.
+// Missing minor and patch numbers are zero, so 1.2 equals 1.2.0.
+type SemVer struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string
+	Build string
+	// segments is the number of numeric segments given, used by ~> constraints.
+	segments int
+}
+
+func ParseSemVer(s string) (SemVer, error) {
+	var v SemVer
+	str := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		str, v.Build = str[:i], str[i+1:]
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		str, v.Pre = str[:i], str[i+1:]
+		if v.Pre == "" {
+			return v, fmt.Errorf("vagrantcloud: invalid version %q", s)
+		}
+	}
+	parts := strings.Split(str, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("vagrantcloud: invalid version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("vagrantcloud: invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	v.segments = len(parts)
+	return v, nil
+}
+
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than o.
+// Build metadata is ignored and a pre-release is lower than its release.
+func (v SemVer) Compare(o SemVer) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	a, b := strings.Split(v.Pre, "."), strings.Split(o.Pre, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := comparePre(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func comparePre(a, b string) int {
+	na, erra := strconv.Atoi(a)
+	nb, errb := strconv.Atoi(b)
+	switch {
+	case erra == nil && errb == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case erra == nil:
+		return -1
+	case errb == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// SemVer parses the version number of v.
+func (v *Version) SemVer() (SemVer, error) {
+	if v.Version != "" {
+		return ParseSemVer(v.Version)
+	}
+	return ParseSemVer(v.Number)
+}
+
+// Versions sorts from the lowest to the highest version;
+// versions that are not valid semver sort first.
+type Versions []Version
+
+func (vs Versions) Len() int {
+	return len(vs)
+}
+
+func (vs Versions) Less(i, j int) bool {
+	a, erra := vs[i].SemVer()
+	b, errb := vs[j].SemVer()
+	switch {
+	case erra != nil && errb != nil:
+		return vs[i].Version < vs[j].Version
+	case erra != nil:
+		return true
+	case errb != nil:
+		return false
+	}
+	return a.Compare(b) < 0
+}
+
+func (vs Versions) Swap(i, j int) {
+	vs[i], vs[j] = vs[j], vs[i]
+}
+
+// Constraint is a Vagrant-style version constraint such as "~> 1.2" or ">= 1.0, < 2.0".
+// Pre-release versions only match if one of the terms names a pre-release.
+type Constraint []constraintTerm
+
+type constraintTerm struct {
+	op string
+	v  SemVer
+}
+
+// constraintOps is ordered so that two character operators are matched first.
+var constraintOps = []string{"~>", ">=", "<=", "!=", "=", ">", "<"}
+
+func ParseConstraint(s string) (Constraint, error) {
+	var c Constraint
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		op := "="
+		for _, o := range constraintOps {
+			if strings.HasPrefix(term, o) {
+				op = o
+				term = strings.TrimSpace(term[len(o):])
+				break
+			}
+		}
+		v, err := ParseSemVer(term)
+		if err != nil {
+			return nil, fmt.Errorf("vagrantcloud: invalid constraint %q", s)
+		}
+		c = append(c, constraintTerm{op, v})
+	}
+	return c, nil
+}
+
+// Match reports whether v satisfies every term of the constraint.
+func (c Constraint) Match(v SemVer) bool {
+	if v.Pre != "" && !c.pre() {
+		return false
+	}
+	for _, t := range c {
+		if !t.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) pre() bool {
+	for _, t := range c {
+		if t.v.Pre != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (t constraintTerm) match(v SemVer) bool {
+	cmp := v.Compare(t.v)
+	switch t.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case "~>":
+		return cmp >= 0 && v.Compare(t.upper()) < 0
+	}
+	return false
+}
+
+// upper is the exclusive upper bound of a ~> term:
+// ~> 1.2 allows < 2.0 and ~> 1.2.3 allows < 1.3.0.
+func (t constraintTerm) upper() SemVer {
+	switch t.v.segments {
+	case 3:
+		return SemVer{Major: t.v.Major, Minor: t.v.Minor + 1}
+	default:
+		return SemVer{Major: t.v.Major + 1}
+	}
+}
+
+// LatestVersion returns the highest active version of the box,
+// or nil if no version has been released.
+func (b *Box) LatestVersion() *Version {
+	v, _ := b.ResolveVersion("", "")
+	return v
+}
+
+// ResolveVersion returns the highest active version that satisfies constraint
+// and has a provider named provider, the same version `vagrant up` would pick.
+// An empty constraint or provider matches any version.
+func (b *Box) ResolveVersion(constraint string, provider ProviderName) (*Version, error) {
+	c, err := ParseConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]int, len(b.Versions))
+	for n := range sorted {
+		sorted[n] = n
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return b.Versions.Less(sorted[j], sorted[i])
+	})
+	for _, n := range sorted {
+		v := &b.Versions[n]
+		if v.Status != VersionActive || !v.hasProvider(provider) {
+			continue
+		}
+		if sv, err := v.SemVer(); err == nil && c.Match(sv) {
+			return v, nil
+		}
+	}
+	return nil, ErrNoMatchingVersion
+}
+
+func (v *Version) hasProvider(name ProviderName) bool {
+	if name == "" {
+		return true
+	}
+	for _, p := range v.Providers {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package vagrantcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BoxFile is a box file opened by a CatalogStore.
+// If it also has a Stat method, like *os.File, its modification time is served.
+type BoxFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// CatalogStore supplies the boxes and box files served by a CatalogServer.
+// Both methods return an error for which errors.Is(err, os.ErrNotExist) is true
+// if there is no such box or file.
+type CatalogStore interface {
+	// Box returns the box with its versions and providers.
+	// The server does not modify it.
+	Box(username, name string) (*Box, error)
+	// Open opens the box file of a provider.
+	Open(username, name, version string, provider ProviderName, arch Architecture) (BoxFile, error)
+}
+
+// CatalogServer serves the Vagrant box metadata protocol from Store, so that
+//
+//	vagrant box add --box-server-url http://localhost:8080 user/box
+//
+// or `vagrant box add http://localhost:8080/user/box` work without Vagrant Cloud:
+//
+//	GET /:username/:name                                      box metadata
+//	GET /:username/:name/metadata.json                        box metadata
+//	GET /:username/:name/version/:version/provider/:provider.box        box file
+//	GET /:username/:name/version/:version/provider/:provider/:arch.box  box file
+//
+// Only active versions are listed.
+// Providers with an OriginalUrl point there, the others are served from Store,
+// with support for Range requests.
+type CatalogServer struct {
+	Store CatalogStore
+	// BaseUrl is the url the server is reachable at, used in the box metadata.
+	// It defaults to the scheme and host of each request;
+	// set it when the server is mounted below a path or behind a proxy.
+	BaseUrl string
+}
+
+func (s *CatalogServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		serveError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, part := range parts {
+		if part == "" || strings.HasPrefix(part, ".") {
+			serveError(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	switch {
+	case len(parts) == 2:
+		s.serveCatalog(w, r, parts[0], parts[1])
+	case len(parts) == 3 && parts[2] == "metadata.json":
+		s.serveCatalog(w, r, parts[0], parts[1])
+	case len(parts) == 6 && parts[2] == "version" && parts[4] == "provider" && strings.HasSuffix(parts[5], ".box"):
+		s.serveFile(w, r, parts[0], parts[1], parts[3], ProviderName(strings.TrimSuffix(parts[5], ".box")), "")
+	case len(parts) == 7 && parts[2] == "version" && parts[4] == "provider" && strings.HasSuffix(parts[6], ".box"):
+		s.serveFile(w, r, parts[0], parts[1], parts[3], ProviderName(parts[5]), Architecture(strings.TrimSuffix(parts[6], ".box")))
+	default:
+		serveError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *CatalogServer) serveCatalog(w http.ResponseWriter, r *http.Request, username, name string) {
+	b, err := s.Store.Box(username, name)
+	if err != nil {
+		serveStoreError(w, err)
+		return
+	}
+	base := s.baseUrl(r)
+	c := b.catalog(func(v *Version, p *Provider) string {
+		if p.OriginalUrl != "" {
+			return p.OriginalUrl
+		}
+		number := v.Version
+		if number == "" {
+			number = v.Number
+		}
+		uri := base + "/" + username + "/" + name + "/version/" + number + "/provider/" + string(p.Name)
+		if p.Architecture != "" {
+			uri += "/" + string(p.Architecture)
+		}
+		return uri + ".box"
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+func (s *CatalogServer) serveFile(w http.ResponseWriter, r *http.Request, username, name, version string, provider ProviderName, arch Architecture) {
+	f, err := s.Store.Open(username, name, version, provider, arch)
+	if err != nil {
+		serveStoreError(w, err)
+		return
+	}
+	defer f.Close()
+	var modtime time.Time
+	if st, ok := f.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if fi, err := st.Stat(); err == nil {
+			modtime = fi.ModTime()
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "vagrant.box", modtime, f)
+}
+
+func (s *CatalogServer) baseUrl(r *http.Request) string {
+	if s.BaseUrl != "" {
+		return strings.TrimSuffix(s.BaseUrl, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// serveError replies in the error format of Vagrant Cloud.
+func serveError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+}
+
+func serveStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, os.ErrNotExist) {
+		serveError(w, http.StatusNotFound, "not found")
+		return
+	}
+	serveError(w, http.StatusInternalServerError, err.Error())
+}
+
+// DirStore serves boxes from a directory laid out as
+//
+//	:username/:name/:version/:provider.box
+//	:username/:name/:version/:provider-:arch.box
+//
+// A checksum is read from a file next to the box named after the checksum type,
+// e.g. virtualbox.box.sha256, holding the hex digest.
+// Every version directory with a box file is active.
+type DirStore string
+
+func (s DirStore) Box(username, name string) (*Box, error) {
+	dir := filepath.Join(string(s), username, name)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	b := &Box{
+		Tag:      username + "/" + name,
+		Username: username,
+		Name:     name,
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		v, err := s.version(filepath.Join(dir, entry.Name()), entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if len(v.Providers) > 0 {
+			b.Versions = append(b.Versions, *v)
+		}
+	}
+	sort.Sort(b.Versions)
+	b.init(nil)
+	return b, nil
+}
+
+var checksumTypes = []ChecksumType{ChecksumSha512, ChecksumSha384, ChecksumSha256, ChecksumSha1, ChecksumMd5}
+
+func (s DirStore) version(dir, number string) (*Version, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	v := &Version{
+		Version: number,
+		Number:  number,
+		Status:  VersionActive,
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".box") {
+			continue
+		}
+		p := Provider{
+			Name:      ProviderName(strings.TrimSuffix(fi.Name(), ".box")),
+			UpdatedAt: fi.ModTime(),
+		}
+		if i := strings.LastIndexByte(string(p.Name), '-'); i > 0 {
+			p.Name, p.Architecture = p.Name[:i], Architecture(p.Name[i+1:])
+		}
+		for _, t := range checksumTypes {
+			data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()+"."+string(t)))
+			if err != nil {
+				continue
+			}
+			if fields := strings.Fields(string(data)); len(fields) > 0 {
+				p.Checksum, p.ChecksumType = fields[0], t
+				break
+			}
+		}
+		v.Providers = append(v.Providers, p)
+	}
+	return v, nil
+}
+
+func (s DirStore) Open(username, name, version string, provider ProviderName, arch Architecture) (BoxFile, error) {
+	fname := string(provider)
+	if arch != "" {
+		fname += "-" + string(arch)
+	}
+	return os.Open(filepath.Join(string(s), username, name, version, fname+".box"))
+}
+
+// MemoryStore serves boxes and box files held in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	boxes map[string]*Box
+	files map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		boxes: map[string]*Box{},
+		files: map[string][]byte{},
+	}
+}
+
+// Add adds the box b, replacing any box with the same username and name.
+// b must not be modified afterwards.
+func (s *MemoryStore) Add(b *Box) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.boxes[b.Username+"/"+b.Name] = b
+}
+
+// AddFile adds the box file of a provider,
+// served unless the provider has an OriginalUrl.
+func (s *MemoryStore) AddFile(username, name, version string, provider ProviderName, arch Architecture, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileKey(username, name, version, provider, arch)] = data
+}
+
+func (s *MemoryStore) Box(username, name string) (*Box, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.boxes[username+"/"+name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return b, nil
+}
+
+func (s *MemoryStore) Open(username, name, version string, provider ProviderName, arch Architecture) (BoxFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, ok := s.files[fileKey(username, name, version, provider, arch)]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+func fileKey(username, name, version string, provider ProviderName, arch Architecture) string {
+	return username + "/" + name + "/" + version + "/" + providerKey(provider, arch)
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
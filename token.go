@@ -0,0 +1,113 @@
+package vagrantcloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+// Tokens are the access tokens used to authenticate with Vagrant Cloud,
+// as returned by Authenticate.
+type Token struct {
+	api         *Api
+	Token       string    `json:"token"`
+	TokenHash   string    `json:"token_hash"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (t *Token) init(a *Api) {
+	t.api = a
+}
+
+// withToken returns a copy of the Api authenticated with token instead.
+func (a *Api) withToken(token string) *Api {
+	c := *a
+	c.source = nil
+	if token != "" {
+		c.source = StaticTokenSource(token)
+	}
+	return &c
+}
+
+// CREATE A TOKEN
+//
+//	username (required)
+//		The username or email address of the account.
+//	password (required)
+//		The password of the account.
+//	description
+//		A description of the token, e.g. where it is used.
+//	twoFactorCode
+//		The current two factor authentication code, if enabled on the account.
+//
+// The returned Token can be passed to New.
+func (a *Api) Authenticate(username, password, description, twoFactorCode string) (*Token, error) {
+	return a.AuthenticateContext(context.Background(), username, password, description, twoFactorCode)
+}
+
+func (a *Api) AuthenticateContext(ctx context.Context, username, password, description, twoFactorCode string) (*Token, error) {
+	params := url.Values{}
+	params.Add("user[login]", username)
+	params.Add("user[password]", password)
+	if description != "" {
+		params.Add("token[description]", description)
+	}
+	if twoFactorCode != "" {
+		params.Add("two_factor[code]", twoFactorCode)
+	}
+	body, err := a.withToken("").PostContext(ctx, "/authenticate", params)
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{}
+	if err := json.Unmarshal(body, t); err != nil {
+		return nil, err
+	}
+	a.secrets.add(t.Token)
+	t.init(a)
+	return t, nil
+}
+
+// VALIDATE A TOKEN
+//
+// Returns nil if the Api's token is valid,
+// otherwise an *Error for which IsUnauthorized is true.
+func (a *Api) ValidateToken() error {
+	return a.ValidateTokenContext(context.Background())
+}
+
+func (a *Api) ValidateTokenContext(ctx context.Context) error {
+	_, err := a.GetContext(ctx, "/authenticate")
+	return err
+}
+
+// REVOKE A TOKEN
+//
+// Revokes the Api's token, e.g. a stale token found by a rotation job:
+//
+//	err := vagrantcloud.New(stale).RevokeToken()
+func (a *Api) RevokeToken() error {
+	return a.RevokeTokenContext(context.Background())
+}
+
+func (a *Api) RevokeTokenContext(ctx context.Context) error {
+	_, err := a.DeleteContext(ctx, "/authenticate")
+	return err
+}
+
+// DELETE A TOKEN
+//
+// Revokes the token returned by Authenticate.
+func (t *Token) Delete() error {
+	return t.DeleteContext(context.Background())
+}
+
+func (t *Token) DeleteContext(ctx context.Context) error {
+	if t.Token == "" {
+		return errors.New("vagrantcloud: the token to delete is unknown")
+	}
+	return t.api.withToken(t.Token).RevokeTokenContext(ctx)
+}
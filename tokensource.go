@@ -0,0 +1,225 @@
+package vagrantcloud
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EnvToken is the environment variable read by EnvTokenSource by default,
+// the same one Vagrant itself uses.
+const EnvToken = "VAGRANT_CLOUD_TOKEN"
+
+// ErrNoToken is returned by a TokenSource that has no token to offer.
+var ErrNoToken = errors.New("vagrantcloud: no access token found")
+
+// TokenSource supplies the access token.
+// It is consulted for every request, so a rotated token is picked up
+// without restarting long-running tools.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// WithTokenSource looks the access token up in source for every request.
+func WithTokenSource(source TokenSource) Option {
+	return func(a *Api) {
+		a.source = source
+	}
+}
+
+// StaticTokenSource always returns the same token.
+type StaticTokenSource string
+
+func (s StaticTokenSource) Token() (string, error) {
+	if s == "" {
+		return "", ErrNoToken
+	}
+	return string(s), nil
+}
+
+// EnvTokenSource reads the token from the named environment variable,
+// or from VAGRANT_CLOUD_TOKEN if the name is empty.
+type EnvTokenSource string
+
+func (s EnvTokenSource) Token() (string, error) {
+	name := string(s)
+	if name == "" {
+		name = EnvToken
+	}
+	token := strings.TrimSpace(os.Getenv(name))
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// FileTokenSource reads the token from the named file,
+// ignoring surrounding white space such as the trailing newline.
+type FileTokenSource string
+
+func (s FileTokenSource) Token() (string, error) {
+	b, err := ioutil.ReadFile(string(s))
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// NetrcTokenSource reads the token from the password of a machine in a netrc file.
+type NetrcTokenSource struct {
+	// File defaults to $NETRC, or ~/.netrc.
+	File string
+	// Machine defaults to vagrantcloud.com.
+	Machine string
+}
+
+func (s NetrcTokenSource) Token() (string, error) {
+	fname := s.File
+	if fname == "" {
+		fname = os.Getenv("NETRC")
+	}
+	if fname == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		fname = filepath.Join(home, ".netrc")
+	}
+	machine := s.Machine
+	if machine == "" {
+		machine = "vagrantcloud.com"
+	}
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return "", err
+	}
+	token := parseNetrc(string(b), machine)
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// parseNetrc returns the password of machine, or of the default entry.
+func parseNetrc(data, machine string) string {
+	var password, fallback string
+	var current string
+	fields := strings.Fields(data)
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			if password != "" {
+				return password
+			}
+			current = ""
+			if i+1 < len(fields) {
+				i++
+				current = fields[i]
+			}
+		case "default":
+			if password != "" {
+				return password
+			}
+			current = "default"
+		case "password":
+			if i+1 >= len(fields) {
+				break
+			}
+			i++
+			switch current {
+			case machine:
+				password = fields[i]
+			case "default":
+				fallback = fields[i]
+			}
+		case "macdef":
+			// macros run until an empty line, which Fields cannot see; stop here
+			if password != "" {
+				return password
+			}
+			return fallback
+		}
+	}
+	if password != "" {
+		return password
+	}
+	return fallback
+}
+
+// HelperTokenSource runs an external credential helper
+// and uses its standard output as the token.
+type HelperTokenSource struct {
+	Command string
+	Args    []string
+}
+
+func (s HelperTokenSource) Token() (string, error) {
+	out, err := exec.Command(s.Command, s.Args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("vagrantcloud: credential helper %s: %v", s.Command, err)
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+// ChainTokenSource tries each source in order and returns the first token found.
+type ChainTokenSource []TokenSource
+
+func (s ChainTokenSource) Token() (string, error) {
+	err := ErrNoToken
+	for _, source := range s {
+		token, e := source.Token()
+		if e == nil && token != "" {
+			return token, nil
+		}
+		if e != nil && e != ErrNoToken && err == ErrNoToken {
+			err = fmt.Errorf("%w: %v", ErrNoToken, e)
+		}
+	}
+	return "", err
+}
+
+// CacheTokenSource remembers the token of source for ttl,
+// for sources such as HelperTokenSource that are too slow to run on every request.
+func CacheTokenSource(source TokenSource, ttl time.Duration) TokenSource {
+	return &cacheTokenSource{
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+type cacheTokenSource struct {
+	mu      sync.Mutex
+	source  TokenSource
+	ttl     time.Duration
+	token   string
+	expires time.Time
+}
+
+func (s *cacheTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+	token, err := s.source.Token()
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.expires = time.Now().Add(s.ttl)
+	return token, nil
+}
@@ -24,9 +24,8 @@ type Version vagrantcloud.Version
 type CodeNames map[string]string
 
 const (
-	url      = "https://cloud-images.ubuntu.com/vagrant/"
-	notFound = "404 Not Found"
-	see      = "\n\nSee https://github.com/larryli/vagrantcloud.v1/tree/master/update-ubuntu-vagrant-box"
+	url = "https://cloud-images.ubuntu.com/vagrant/"
+	see = "\n\nSee https://github.com/larryli/vagrantcloud.v1/tree/master/update-ubuntu-vagrant-box"
 )
 
 var (
@@ -34,8 +33,9 @@ var (
 	names    = CodeNames{}
 	username = flag.String("username", "larryli", "username")
 	token    = flag.String("token", "", "access_token")
-	test     = flag.Bool("test", false, "test, no effect")
+	test     = flag.Bool("test", false, "test, log the changes without making them")
 	codename = flag.String("codename", "", "ubuntu code name file(json)")
+	rate     = flag.Float64("rate", 0, "max api requests per second, 0 is unlimited")
 	arches   = []Arch{
 		{
 			name: "64",
@@ -138,13 +138,11 @@ func (r Release) scan() {
 		box := api.Box(*username, r.name()+t.name)
 		todo := fmt.Sprintf("fetch \"%s\"", box.Uri())
 		err := box.Get()
-		if err != nil && strings.EqualFold(err.Error(), notFound) {
+		if vagrantcloud.IsNotFound(err) {
 			box.ShortDescription = r.title(t.info, "")
 			box.DescriptionMarkdown = r.url() + see
 			todo = fmt.Sprintf("add \"%s\"", box.Uri())
-			if !(*test) {
-				fatal(box.New(), todo)
-			}
+			fatal(box.New(), todo)
 			log.Println(todo)
 		} else {
 			fatal(err, todo)
@@ -162,9 +160,7 @@ func (r Release) scan() {
 				b.add(version, image)
 				box.ShortDescription = r.title(t.info, version)
 				todo = fmt.Sprintf("update \"%s\": \"%s\"", box.Uri(), box.ShortDescription)
-				if !(*test) {
-					fatal(box.Set(), todo)
-				}
+				fatal(box.Set(), todo)
 				log.Println(todo)
 			}
 		}
@@ -184,9 +180,7 @@ func (v *Version) exists(versions []string) (found bool) {
 func (v *Version) delete() {
 	version := (*vagrantcloud.Version)(v)
 	todo := fmt.Sprintf("delete \"%s\" Version: \"%s\"", version.Uri(), version.Version)
-	if !(*test) {
-		fatal(version.Delete(), todo)
-	}
+	fatal(version.Delete(), todo)
 	log.Println(todo)
 }
 
@@ -206,19 +200,13 @@ func (b *Box) add(version, image string) {
 	v.Version = version
 	v.DescriptionMarkdown = image + see
 	todo := fmt.Sprintf("add \"%s\" Version: \"%s\"", v.Uri(), v.Version)
-	if !(*test) {
-		fatal(v.New(), todo)
-	}
+	fatal(v.New(), todo)
 	p := v.Provider(vagrantcloud.ProviderVirtualbox)
 	p.OriginalUrl = image
 	todo = fmt.Sprintf("add \"%s\" Version: \"%s\"", p.Uri(), v.Version)
-	if !(*test) {
-		fatal(p.New(), todo)
-	}
+	fatal(p.New(), todo)
 	todo = fmt.Sprintf("public \"%s\" Version: \"%s\" Url: \"%s\"", v.Uri(), v.Version, p.OriginalUrl)
-	if !(*test) {
-		fatal(v.Release(), todo)
-	}
+	fatal(v.Release(), todo)
 	log.Println(todo)
 }
 
@@ -228,11 +216,18 @@ func main() {
 		flag.Usage()
 	} else {
 		initCodeNames()
-		api = vagrantcloud.New(*token)
+		opts := []vagrantcloud.Option{vagrantcloud.WithRateLimit(*rate, 1)}
+		if *test {
+			opts = append(opts, vagrantcloud.WithDryRun())
+		}
+		api = vagrantcloud.New(*token, opts...)
 		log.Println("start")
 		for _, release := range fetchReleases() {
 			release.scan()
 		}
+		for _, change := range api.Changes() {
+			log.Println("test:", change)
+		}
 		log.Println("end")
 	}
 }
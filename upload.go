@@ -0,0 +1,240 @@
+package vagrantcloud
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uploadAttempts is the minimum number of attempts for a file upload,
+// which can always be rewound, even without a RetryPolicy.
+const uploadAttempts = 3
+
+// verifyInterval is how often the provider is polled for its hosted token after an upload.
+const verifyInterval = time.Second
+
+// WithUploadTimeout sets how long to wait, after a box has been uploaded,
+// for Vagrant Cloud to confirm it with a matching hosted token.
+// Defaults to one minute.
+func WithUploadTimeout(d time.Duration) Option {
+	return func(a *Api) {
+		a.uploadTimeout = d
+	}
+}
+
+// HostedTokenError is returned when an upload was not confirmed in time:
+// the provider's hosted token did not match the token of the upload.
+type HostedTokenError struct {
+	Want string
+	Got  string
+}
+
+func (e *HostedTokenError) Error() string {
+	return "vagrantcloud: upload not confirmed, hosted token does not match"
+}
+
+// Progress is called while a box is transferred
+// with the number of bytes done so far and the total size.
+type Progress func(done, total int64)
+
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress Progress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.done += int64(n)
+		if r.progress != nil {
+			r.progress(r.done, r.total)
+		}
+	}
+	return n, err
+}
+
+func (a *Api) UploadFile(uri, fname string, progress Progress) ([]byte, error) {
+	return a.UploadFileContext(context.Background(), uri, fname, progress)
+}
+
+// UploadFileContext PUTs the file fname to uri with its Content-Length set.
+//
+// When an attempt fails, the server is asked how much it has received
+// with an empty PUT carrying "Content-Range: bytes */size".
+// If it answers 308 with a Range header, the upload resumes after that offset,
+// or is complete if the range covers the whole file;
+// otherwise the whole file is sent again.
+func (a *Api) UploadFileContext(ctx context.Context, uri, fname string, progress Progress) ([]byte, error) {
+	if a.dryRun != nil {
+		a.dryRun.add(Change{Method: "PUT", Uri: uri, File: fname})
+		return []byte("{}"), nil
+	}
+	u, err := url.ParseRequestURI(a.buildUrl(uri))
+	if err != nil {
+		return nil, err
+	}
+	if err := a.authorizeQuery(u); err != nil {
+		return nil, a.redact(err)
+	}
+	body, err := a.uploadFile(ctx, u.String(), fname, progress, nil)
+	return body, a.redact(err)
+}
+
+// uploadFile PUTs the file fname to rawurl.
+// If h is not nil, it holds the hash of the whole file on success.
+func (a *Api) uploadFile(ctx context.Context, rawurl, fname string, progress Progress, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	policy := a.retry.withDefaults()
+	attempts := policy.MaxAttempts
+	if attempts < uploadAttempts {
+		attempts = uploadAttempts
+	}
+	var offset int64
+	for attempt := 1; ; attempt++ {
+		var w io.Writer
+		if h != nil && offset == 0 {
+			h.Reset()
+			w = h
+		}
+		var body []byte
+		var err error
+		if offset > 0 && offset >= size {
+			// the server confirmed the whole file, only its answer was lost
+			if progress != nil {
+				progress(size, size)
+			}
+		} else {
+			body, err = a.uploadRange(ctx, rawurl, f, offset, size, progress, w)
+		}
+		if err == nil && h != nil && offset > 0 {
+			// the hash only covers the first attempt, start over from the file
+			h.Reset()
+			_, err = io.Copy(h, io.NewSectionReader(f, 0, size))
+		}
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !transient(err) {
+			return body, err
+		}
+		if err := sleep(ctx, policy.backoff(attempt, err)); err != nil {
+			return nil, err
+		}
+		offset = a.uploadOffset(ctx, rawurl, size)
+	}
+}
+
+func (a *Api) uploadRange(ctx context.Context, rawurl string, f *os.File, offset, size int64, progress Progress, w io.Writer) ([]byte, error) {
+	var body io.Reader = http.NoBody
+	if offset < size {
+		var r io.Reader = io.NewSectionReader(f, offset, size-offset)
+		if w != nil {
+			r = io.TeeReader(r, w)
+		}
+		body = &progressReader{
+			r:        r,
+			done:     offset,
+			total:    size,
+			progress: progress,
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", rawurl, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size - offset
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if offset > 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	}
+	if progress != nil {
+		progress(offset, size)
+	}
+	if err := a.authorize(req); err != nil {
+		return nil, err
+	}
+	return a.send(req)
+}
+
+// uploadOffset asks the server how many bytes of the upload it has confirmed.
+// It returns 0, restarting the upload, unless the server answers
+// 308 Resume Incomplete with a Range header;
+// it returns size if the server has the whole file.
+func (a *Api) uploadOffset(ctx context.Context, rawurl string, size int64) int64 {
+	req, err := http.NewRequestWithContext(ctx, "PUT", rawurl, http.NoBody)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	if err := a.authorize(req); err != nil {
+		return 0
+	}
+	release, err := a.acquire(ctx)
+	if err != nil {
+		return 0
+	}
+	defer release()
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPermanentRedirect {
+		return 0
+	}
+	r := strings.TrimPrefix(resp.Header.Get("Range"), "bytes=")
+	if i := strings.IndexByte(r, '-'); i >= 0 {
+		if n, err := strconv.ParseInt(r[i+1:], 10, 64); err == nil && n < size {
+			return n + 1
+		}
+	}
+	return 0
+}
+
+// putUrl streams data to an absolute upload url returned by Vagrant Cloud.
+// The access token is only sent along if the url is on the Api's own host.
+func (a *Api) putUrl(ctx context.Context, rawurl string, data io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "PUT", rawurl, data)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if err := a.authorize(req); err != nil {
+		return nil, a.redact(err)
+	}
+	body, err := a.send(req)
+	return body, a.redact(err)
+}
+
+// uploadUrl resolves an upload_path, which may be relative to the Api's endpoint.
+func (a *Api) uploadUrl(path string) (string, error) {
+	base, err := url.Parse(a.baseUrl + "/")
+	if err != nil {
+		return "", err
+	}
+	u, err := base.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	if a.ownHost(u) {
+		if err := a.authorizeQuery(u); err != nil {
+			return "", err
+		}
+	}
+	return u.String(), nil
+}
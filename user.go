@@ -0,0 +1,155 @@
+package vagrantcloud
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Users own boxes and may be members of organizations.
+type User struct {
+	api             *Api
+	Username        string `json:"username"`
+	AvatarUrl       string `json:"avatar_url"`
+	ProfileHtml     string `json:"profile_html"`
+	ProfileMarkdown string `json:"profile_markdown"`
+	Boxes           []Box  `json:"boxes"`
+}
+
+func (a *Api) User(username string) *User {
+	u := &User{
+		Username: username,
+	}
+	u.init(a)
+	return u
+}
+
+func (u *User) init(a *Api) {
+	u.api = a
+	for n := range u.Boxes {
+		(&u.Boxes[n]).init(a)
+	}
+}
+
+func (u *User) parseBody(body []byte) error {
+	err := json.Unmarshal(body, u)
+	if err != nil {
+		return err
+	}
+	u.init(u.api)
+	return nil
+}
+
+func (u *User) Uri() string {
+	return "/user/" + u.Username
+}
+
+// RETRIEVE A USER
+//
+//	Username (required)
+//		The username of the user.
+//
+// The profile is returned with the boxes the token has access to.
+func (u *User) Get() error {
+	return u.GetContext(context.Background())
+}
+
+func (u *User) GetContext(ctx context.Context) error {
+	body, err := u.api.GetContext(ctx, u.Uri())
+	if err != nil {
+		return err
+	}
+	return u.parseBody(body)
+}
+
+// Box returns the box name owned by the user.
+func (u *User) Box(name string) *Box {
+	return u.api.Box(u.Username, name)
+}
+
+// Organizations own boxes on behalf of their members.
+// Organizations share the username namespace with users,
+// so Box.Username may name an organization:
+//
+//	box := api.Organization("yourorg").Box("boxname")
+//	err := box.New()
+//
+// creates the box under the organization, provided the token's user is a member.
+type Organization struct {
+	api             *Api
+	Username        string `json:"username"`
+	AvatarUrl       string `json:"avatar_url"`
+	ProfileHtml     string `json:"profile_html"`
+	ProfileMarkdown string `json:"profile_markdown"`
+	Boxes           []Box  `json:"boxes"`
+	// Members is only filled if Vagrant Cloud lists them with the organization,
+	// which its documented user resource does not.
+	Members []User `json:"members"`
+}
+
+func (a *Api) Organization(name string) *Organization {
+	o := &Organization{
+		Username: name,
+	}
+	o.init(a)
+	return o
+}
+
+func (o *Organization) init(a *Api) {
+	o.api = a
+	for n := range o.Boxes {
+		(&o.Boxes[n]).init(a)
+	}
+	for n := range o.Members {
+		(&o.Members[n]).init(a)
+	}
+}
+
+func (o *Organization) parseBody(body []byte) error {
+	err := json.Unmarshal(body, o)
+	if err != nil {
+		return err
+	}
+	o.init(o.api)
+	return nil
+}
+
+// Uri is the user resource of the organization,
+// as organizations share the username namespace with users.
+func (o *Organization) Uri() string {
+	return "/user/" + o.Username
+}
+
+// RETRIEVE AN ORGANIZATION
+//
+//	Username (required)
+//		The name of the organization.
+//
+// The profile is returned with the boxes the token has access to.
+func (o *Organization) Get() error {
+	return o.GetContext(context.Background())
+}
+
+func (o *Organization) GetContext(ctx context.Context) error {
+	body, err := o.api.GetContext(ctx, o.Uri())
+	if err != nil {
+		return err
+	}
+	return o.parseBody(body)
+}
+
+// Box returns the box name owned by the organization.
+func (o *Organization) Box(name string) *Box {
+	return o.api.Box(o.Username, name)
+}
+
+// IsMember reports whether username is among the Members returned by Get.
+// It is false for everyone if Get returned no members,
+// so it cannot tell a non-member from an unknown membership.
+func (o *Organization) IsMember(username string) bool {
+	for _, m := range o.Members {
+		if m.Username == username {
+			return true
+		}
+	}
+	return false
+}
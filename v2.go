@@ -0,0 +1,89 @@
+package vagrantcloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type ApiVersion string
+
+const (
+	ApiV1 ApiVersion = "v1"
+	ApiV2 ApiVersion = "v2"
+)
+
+// WithApiVersion selects the version of the Vagrant Cloud API to speak.
+// Defaults to ApiV1.
+//
+// The v2 API takes JSON request bodies and addresses providers by architecture,
+// /box/:username/:name/version/:version/provider/:provider/:architecture,
+// but returns the same Box, Version and Provider resources.
+// A Provider without an Architecture is created and addressed as unknown there,
+// and boxes are uploaded directly to storage, confirmed by the upload callback.
+// It is also served by the HCP Vagrant Box Registry;
+// point WithBaseUrl at the registry endpoint and use an HCP token.
+// The access token is always sent in the Authorization header with v2.
+func WithApiVersion(v ApiVersion) Option {
+	return func(a *Api) {
+		a.version = v
+	}
+}
+
+// v2Architecture is the architecture segment of a v2 provider path.
+// A provider without an architecture is addressed as unknown,
+// as Vagrant does for boxes that do not name one.
+func v2Architecture(arch Architecture) Architecture {
+	if arch == "" {
+		return ArchitectureUnknown
+	}
+	return arch
+}
+
+// boolParams are the form parameters sent as JSON booleans by v2.
+var boolParams = map[string]bool{
+	"is_private":           true,
+	"default_architecture": true,
+}
+
+// encode returns params as a request body in the encoding of the Api's version.
+func (a *Api) encode(params url.Values) io.Reader {
+	if a.version != ApiV2 {
+		return strings.NewReader(params.Encode())
+	}
+	return bytes.NewReader(encodeJson(params))
+}
+
+// encodeJson turns form parameters such as box[name] into a JSON object:
+//
+//	{"box": {"name": "..."}}
+func encodeJson(params url.Values) []byte {
+	obj := map[string]interface{}{}
+	for key, values := range params {
+		if len(values) == 0 {
+			continue
+		}
+		i := strings.IndexByte(key, '[')
+		if i <= 0 || !strings.HasSuffix(key, "]") {
+			obj[key] = values[0]
+			continue
+		}
+		name, field := key[:i], key[i+1:len(key)-1]
+		m, ok := obj[name].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			obj[name] = m
+		}
+		m[field] = values[0]
+		if boolParams[field] {
+			if b, err := strconv.ParseBool(values[0]); err == nil {
+				m[field] = b
+			}
+		}
+	}
+	body, _ := json.Marshal(obj)
+	return body
+}
@@ -0,0 +1,287 @@
+package vagrantcloudtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Interaction is a recorded request and its response.
+// Access tokens and passwords are never recorded:
+// they are dropped from form requests and replaced by Redacted in JSON.
+type Interaction struct {
+	Method string `json:"method"`
+	// Path is the request path with its query.
+	Path string `json:"path"`
+	Body string `json:"body,omitempty"`
+
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response,omitempty"`
+}
+
+// Redacted replaces the access tokens in recorded responses.
+const Redacted = "REDACTED"
+
+// Cassette is an http.RoundTripper that records exchanges to a JSON fixture file
+// or replays them from it:
+//
+//	c := vagrantcloudtest.NewRecorder("testdata/fixture.json", nil)
+//	api := vagrantcloud.New(token, vagrantcloud.WithHttpClient(c.Client()))
+//	...
+//	err := c.Save()
+//
+//	c, err := vagrantcloudtest.LoadCassette("testdata/fixture.json")
+//	api := vagrantcloud.New("token", vagrantcloud.WithHttpClient(c.Client()))
+//
+// Requests are matched by method, path and body, ignoring the host,
+// and each recorded interaction is replayed once, in order.
+type Cassette struct {
+	fname     string
+	transport http.RoundTripper
+	recording bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// NewRecorder records the exchanges made through transport,
+// or http.DefaultTransport if nil, until Save writes them to fname.
+func NewRecorder(fname string, transport http.RoundTripper) *Cassette {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Cassette{
+		fname:     fname,
+		transport: transport,
+		recording: true,
+	}
+}
+
+// LoadCassette replays the exchanges saved in fname without any network access.
+func LoadCassette(fname string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{
+		fname: fname,
+	}
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return nil, fmt.Errorf("vagrantcloudtest: cassette %s: %v", fname, err)
+	}
+	c.used = make([]bool, len(c.interactions))
+	return c, nil
+}
+
+// Client returns an http.Client using the cassette, for vagrantcloud.WithHttpClient.
+func (c *Cassette) Client() *http.Client {
+	return &http.Client{
+		Transport: c,
+	}
+}
+
+// Save writes the recorded interactions to the fixture file.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.fname, append(data, '\n'), 0644)
+}
+
+// Unused returns the recorded interactions that were not replayed.
+func (c *Cassette) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var unused []Interaction
+	for n, used := range c.used {
+		if !used {
+			unused = append(unused, c.interactions[n])
+		}
+	}
+	return unused
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	in := Interaction{
+		Method: req.Method,
+		Path:   scrubPath(req.URL),
+		Body:   scrubBody(req.Header.Get("Content-Type"), body),
+	}
+	if c.recording {
+		return c.record(req, in)
+	}
+	return c.replay(req, in)
+}
+
+func (c *Cassette) record(req *http.Request, in Interaction) (*http.Response, error) {
+	resp, err := c.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	in.Status = resp.StatusCode
+	secrets := requestSecrets(req)
+	in.Header = http.Header{}
+	for _, key := range []string{"Content-Type", "Location", "Range", "Retry-After"} {
+		if v := resp.Header.Get(key); v != "" {
+			in.Header.Set(key, scrubSecrets(v, secrets))
+		}
+	}
+	in.Response = scrubSecrets(scrubResponse(resp.Header.Get("Content-Type"), data), secrets)
+	c.mu.Lock()
+	c.interactions = append(c.interactions, in)
+	c.used = append(c.used, true)
+	c.mu.Unlock()
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, in Interaction) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, rec := range c.interactions {
+		if c.used[n] || rec.Method != in.Method || rec.Path != in.Path || rec.Body != in.Body {
+			continue
+		}
+		c.used[n] = true
+		header := http.Header{}
+		for key, values := range rec.Header {
+			header[key] = values
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+			StatusCode:    rec.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(rec.Response)),
+			ContentLength: int64(len(rec.Response)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("vagrantcloudtest: cassette %s has no interaction for %s %s", c.fname, in.Method, in.Path)
+}
+
+// scrubPath returns the path and query of u without the access token.
+func scrubPath(u *url.URL) string {
+	q := u.Query()
+	q.Del("access_token")
+	if len(q) == 0 {
+		return u.Path
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+// scrubBody removes the access token and password from a form body,
+// or replaces them by Redacted in a JSON body, as sent by the v2 API.
+func scrubBody(contentType string, body []byte) string {
+	if strings.HasPrefix(contentType, "application/json") {
+		return scrubResponse(contentType, body)
+	}
+	if !strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return string(body)
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return string(body)
+	}
+	form.Del("access_token")
+	form.Del("user[password]")
+	return form.Encode()
+}
+
+// requestSecrets returns the access tokens sent with req.
+func requestSecrets(req *http.Request) []string {
+	var secrets []string
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		secrets = append(secrets, strings.TrimPrefix(auth, "Bearer "))
+	}
+	if token := req.URL.Query().Get("access_token"); token != "" {
+		secrets = append(secrets, token)
+	}
+	return secrets
+}
+
+// scrubSecrets replaces the secrets in s by Redacted.
+func scrubSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.Replace(s, secret, Redacted, -1)
+		}
+	}
+	return s
+}
+
+// scrubResponse replaces the secrets in a JSON body by Redacted,
+// e.g. the token returned by POST /authenticate.
+func scrubResponse(contentType string, data []byte) string {
+	if !strings.HasPrefix(contentType, "application/json") {
+		return string(data)
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil || !scrubJson(v) {
+		return string(data)
+	}
+	scrubbed, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	return string(scrubbed)
+}
+
+// secretFields are the JSON fields scrubJson replaces.
+var secretFields = map[string]bool{
+	"token":        true,
+	"access_token": true,
+	"password":     true,
+}
+
+// scrubJson replaces the secret fields in v by Redacted,
+// and reports whether it found any.
+func scrubJson(v interface{}) bool {
+	found := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, ok := value.(string); ok && secretFields[key] {
+				v[key] = Redacted
+				found = true
+			} else if scrubJson(value) {
+				found = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if scrubJson(value) {
+				found = true
+			}
+		}
+	}
+	return found
+}
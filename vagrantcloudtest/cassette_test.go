@@ -0,0 +1,129 @@
+package vagrantcloudtest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/larryli/vagrantcloud.v1"
+	"github.com/larryli/vagrantcloud.v1/vagrantcloudtest"
+)
+
+func TestCassette(t *testing.T) {
+	s := vagrantcloudtest.NewServer()
+	defer s.Close()
+	s.AddUser("user", "secret")
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+
+	c := vagrantcloudtest.NewRecorder(fixture, nil)
+	api := s.Api("secret", vagrantcloud.WithHttpClient(c.Client()), vagrantcloud.WithQueryToken())
+	box := api.Box("user", "test")
+	if err := box.New(); err != nil {
+		t.Fatal(err)
+	}
+	if err := box.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(fixture)
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("token recorded in %s", data)
+	}
+
+	s.Close()
+	c, err := vagrantcloudtest.LoadCassette(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api = s.Api("other", vagrantcloud.WithHttpClient(c.Client()), vagrantcloud.WithQueryToken())
+	box = api.Box("user", "test")
+	if err := box.New(); err != nil {
+		t.Fatal(err)
+	}
+	if err := box.Get(); err != nil || box.Tag != "user/test" {
+		t.Fatalf("unexpected box %+v %v", box, err)
+	}
+	if err := box.Delete(); err == nil {
+		t.Fatal("replayed an unrecorded request")
+	}
+	if len(c.Unused()) != 0 {
+		t.Fatalf("unused interactions %+v", c.Unused())
+	}
+}
+
+func TestCassetteAuthenticate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "POST":
+			w.Write([]byte(`{"token":"minted","token_hash":"hash","description":"ci"}`))
+		case "GET":
+			w.Write([]byte(`{"access_token":"` + strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ") + `"}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer ts.Close()
+	fixture := filepath.Join(t.TempDir(), "fixture.json")
+
+	c := vagrantcloudtest.NewRecorder(fixture, nil)
+	api := vagrantcloud.New("", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithHttpClient(c.Client()))
+	tok, err := api.Authenticate("user", "hunter2", "ci", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "minted" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+	if err := vagrantcloud.New(tok.Token, vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithHttpClient(c.Client())).ValidateToken(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(fixture)
+	if strings.Contains(string(data), "minted") || strings.Contains(string(data), "hunter2") {
+		t.Fatalf("secret recorded in %s", data)
+	}
+
+	c, err = vagrantcloudtest.LoadCassette(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api = vagrantcloud.New("", vagrantcloud.WithHttpClient(c.Client()))
+	tok, err = api.Authenticate("user", "hunter2", "ci", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != vagrantcloudtest.Redacted || tok.TokenHash != "hash" {
+		t.Fatalf("unexpected token %+v", tok)
+	}
+
+	// v2 sends the credentials as JSON
+	c = vagrantcloudtest.NewRecorder(fixture, nil)
+	api = vagrantcloud.New("", vagrantcloud.WithBaseUrl(ts.URL), vagrantcloud.WithHttpClient(c.Client()),
+		vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	if _, err := api.Authenticate("user", "hunter2", "ci", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = ioutil.ReadFile(fixture)
+	if strings.Contains(string(data), "minted") || strings.Contains(string(data), "hunter2") {
+		t.Fatalf("secret recorded in %s", data)
+	}
+	c, err = vagrantcloudtest.LoadCassette(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api = vagrantcloud.New("", vagrantcloud.WithHttpClient(c.Client()), vagrantcloud.WithApiVersion(vagrantcloud.ApiV2))
+	if tok, err = api.Authenticate("user", "hunter2", "ci", ""); err != nil || tok.Token != vagrantcloudtest.Redacted {
+		t.Fatalf("unexpected token %+v %v", tok, err)
+	}
+}
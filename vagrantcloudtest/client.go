@@ -0,0 +1,179 @@
+package vagrantcloudtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/larryli/vagrantcloud.v1"
+)
+
+// ErrNotImplemented is returned by Client methods without a function set.
+var ErrNotImplemented = errors.New("vagrantcloudtest: not implemented")
+
+// Call is a call recorded by Client: the method name and its arguments after ctx.
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Client is a mock vagrantcloud.Client.
+// Each method calls the function of the same name with the Func suffix,
+// or returns ErrNotImplemented if it is nil, and records the call.
+type Client struct {
+	GetBoxFunc    func(ctx context.Context, username, name string) (vagrantcloud.Box, error)
+	CreateBoxFunc func(ctx context.Context, box vagrantcloud.Box) (vagrantcloud.Box, error)
+	UpdateBoxFunc func(ctx context.Context, box vagrantcloud.Box) (vagrantcloud.Box, error)
+	DeleteBoxFunc func(ctx context.Context, username, name string) error
+
+	GetVersionFunc     func(ctx context.Context, username, name, version string) (vagrantcloud.Version, error)
+	CreateVersionFunc  func(ctx context.Context, username, name string, version vagrantcloud.Version) (vagrantcloud.Version, error)
+	UpdateVersionFunc  func(ctx context.Context, username, name string, version vagrantcloud.Version) (vagrantcloud.Version, error)
+	DeleteVersionFunc  func(ctx context.Context, username, name, version string) error
+	ReleaseVersionFunc func(ctx context.Context, username, name, version string) (vagrantcloud.Version, error)
+	RevokeVersionFunc  func(ctx context.Context, username, name, version string) (vagrantcloud.Version, error)
+
+	GetProviderFunc    func(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture) (vagrantcloud.Provider, error)
+	CreateProviderFunc func(ctx context.Context, username, name, version string, provider vagrantcloud.Provider) (vagrantcloud.Provider, error)
+	UpdateProviderFunc func(ctx context.Context, username, name, version string, provider vagrantcloud.Provider) (vagrantcloud.Provider, error)
+	DeleteProviderFunc func(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture) error
+	UploadProviderFunc func(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture, fname string) error
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+var _ vagrantcloud.Client = (*Client)(nil)
+
+// Calls returns the calls made so far, in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+func (c *Client) record(method string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, Call{Method: method, Args: args})
+}
+
+func (c *Client) GetBox(ctx context.Context, username, name string) (vagrantcloud.Box, error) {
+	c.record("GetBox", username, name)
+	if c.GetBoxFunc == nil {
+		return vagrantcloud.Box{}, ErrNotImplemented
+	}
+	return c.GetBoxFunc(ctx, username, name)
+}
+
+func (c *Client) CreateBox(ctx context.Context, box vagrantcloud.Box) (vagrantcloud.Box, error) {
+	c.record("CreateBox", box)
+	if c.CreateBoxFunc == nil {
+		return vagrantcloud.Box{}, ErrNotImplemented
+	}
+	return c.CreateBoxFunc(ctx, box)
+}
+
+func (c *Client) UpdateBox(ctx context.Context, box vagrantcloud.Box) (vagrantcloud.Box, error) {
+	c.record("UpdateBox", box)
+	if c.UpdateBoxFunc == nil {
+		return vagrantcloud.Box{}, ErrNotImplemented
+	}
+	return c.UpdateBoxFunc(ctx, box)
+}
+
+func (c *Client) DeleteBox(ctx context.Context, username, name string) error {
+	c.record("DeleteBox", username, name)
+	if c.DeleteBoxFunc == nil {
+		return ErrNotImplemented
+	}
+	return c.DeleteBoxFunc(ctx, username, name)
+}
+
+func (c *Client) GetVersion(ctx context.Context, username, name, version string) (vagrantcloud.Version, error) {
+	c.record("GetVersion", username, name, version)
+	if c.GetVersionFunc == nil {
+		return vagrantcloud.Version{}, ErrNotImplemented
+	}
+	return c.GetVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) CreateVersion(ctx context.Context, username, name string, version vagrantcloud.Version) (vagrantcloud.Version, error) {
+	c.record("CreateVersion", username, name, version)
+	if c.CreateVersionFunc == nil {
+		return vagrantcloud.Version{}, ErrNotImplemented
+	}
+	return c.CreateVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) UpdateVersion(ctx context.Context, username, name string, version vagrantcloud.Version) (vagrantcloud.Version, error) {
+	c.record("UpdateVersion", username, name, version)
+	if c.UpdateVersionFunc == nil {
+		return vagrantcloud.Version{}, ErrNotImplemented
+	}
+	return c.UpdateVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) DeleteVersion(ctx context.Context, username, name, version string) error {
+	c.record("DeleteVersion", username, name, version)
+	if c.DeleteVersionFunc == nil {
+		return ErrNotImplemented
+	}
+	return c.DeleteVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) ReleaseVersion(ctx context.Context, username, name, version string) (vagrantcloud.Version, error) {
+	c.record("ReleaseVersion", username, name, version)
+	if c.ReleaseVersionFunc == nil {
+		return vagrantcloud.Version{}, ErrNotImplemented
+	}
+	return c.ReleaseVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) RevokeVersion(ctx context.Context, username, name, version string) (vagrantcloud.Version, error) {
+	c.record("RevokeVersion", username, name, version)
+	if c.RevokeVersionFunc == nil {
+		return vagrantcloud.Version{}, ErrNotImplemented
+	}
+	return c.RevokeVersionFunc(ctx, username, name, version)
+}
+
+func (c *Client) GetProvider(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture) (vagrantcloud.Provider, error) {
+	c.record("GetProvider", username, name, version, provider, arch)
+	if c.GetProviderFunc == nil {
+		return vagrantcloud.Provider{}, ErrNotImplemented
+	}
+	return c.GetProviderFunc(ctx, username, name, version, provider, arch)
+}
+
+func (c *Client) CreateProvider(ctx context.Context, username, name, version string, provider vagrantcloud.Provider) (vagrantcloud.Provider, error) {
+	c.record("CreateProvider", username, name, version, provider)
+	if c.CreateProviderFunc == nil {
+		return vagrantcloud.Provider{}, ErrNotImplemented
+	}
+	return c.CreateProviderFunc(ctx, username, name, version, provider)
+}
+
+func (c *Client) UpdateProvider(ctx context.Context, username, name, version string, provider vagrantcloud.Provider) (vagrantcloud.Provider, error) {
+	c.record("UpdateProvider", username, name, version, provider)
+	if c.UpdateProviderFunc == nil {
+		return vagrantcloud.Provider{}, ErrNotImplemented
+	}
+	return c.UpdateProviderFunc(ctx, username, name, version, provider)
+}
+
+func (c *Client) DeleteProvider(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture) error {
+	c.record("DeleteProvider", username, name, version, provider, arch)
+	if c.DeleteProviderFunc == nil {
+		return ErrNotImplemented
+	}
+	return c.DeleteProviderFunc(ctx, username, name, version, provider, arch)
+}
+
+func (c *Client) UploadProvider(ctx context.Context, username, name, version string, provider vagrantcloud.ProviderName, arch vagrantcloud.Architecture, fname string) error {
+	c.record("UploadProvider", username, name, version, provider, arch, fname)
+	if c.UploadProviderFunc == nil {
+		return ErrNotImplemented
+	}
+	return c.UploadProviderFunc(ctx, username, name, version, provider, arch, fname)
+}
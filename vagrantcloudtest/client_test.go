@@ -0,0 +1,58 @@
+package vagrantcloudtest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/larryli/vagrantcloud.v1"
+	"github.com/larryli/vagrantcloud.v1/vagrantcloudtest"
+)
+
+// release is code under test that only depends on vagrantcloud.Client.
+func release(ctx context.Context, c vagrantcloud.Client, version, url string) error {
+	if _, err := c.CreateVersion(ctx, "user", "test", vagrantcloud.Version{Version: version}); err != nil {
+		return err
+	}
+	p := vagrantcloud.Provider{Name: vagrantcloud.ProviderVirtualbox, OriginalUrl: url}
+	if _, err := c.CreateProvider(ctx, "user", "test", version, p); err != nil {
+		return err
+	}
+	_, err := c.ReleaseVersion(ctx, "user", "test", version)
+	return err
+}
+
+func TestClient(t *testing.T) {
+	s := vagrantcloudtest.NewServer()
+	defer s.Close()
+	s.AddUser("user", "token")
+	api := s.Api("token")
+	ctx := context.Background()
+	if _, err := api.CreateBox(ctx, vagrantcloud.Box{Username: "user", Name: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := release(ctx, api, "1.0.0", "http://box"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := api.GetVersion(ctx, "user", "test", "1.0.0")
+	if err != nil || v.Status != vagrantcloud.VersionActive || v.Providers[0].OriginalUrl != "http://box" {
+		t.Fatalf("unexpected version %+v %v", v, err)
+	}
+}
+
+func TestMockClient(t *testing.T) {
+	c := &vagrantcloudtest.Client{
+		CreateVersionFunc: func(ctx context.Context, username, name string, version vagrantcloud.Version) (vagrantcloud.Version, error) {
+			return version, nil
+		},
+		CreateProviderFunc: func(ctx context.Context, username, name, version string, provider vagrantcloud.Provider) (vagrantcloud.Provider, error) {
+			return provider, nil
+		},
+	}
+	if err := release(context.Background(), c, "1.0.0", "http://box"); err != vagrantcloudtest.ErrNotImplemented {
+		t.Fatalf("unexpected error %v", err)
+	}
+	calls := c.Calls()
+	if len(calls) != 3 || calls[2].Method != "ReleaseVersion" || calls[2].Args[2] != "1.0.0" {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
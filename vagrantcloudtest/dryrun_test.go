@@ -0,0 +1,83 @@
+package vagrantcloudtest_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/larryli/vagrantcloud.v1"
+	"github.com/larryli/vagrantcloud.v1/vagrantcloudtest"
+)
+
+func TestDryRun(t *testing.T) {
+	s := vagrantcloudtest.NewServer()
+	defer s.Close()
+	s.AddUser("user", "token")
+	if err := s.Api("token").Box("user", "old").New(); err != nil {
+		t.Fatal(err)
+	}
+	api := s.Api("token", vagrantcloud.WithDryRun())
+
+	box := api.Box("user", "test")
+	box.ShortDescription = "Test"
+	if err := box.New(); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "test.box")
+	ioutil.WriteFile(fname, []byte("box data"), 0644)
+	v, err := box.Publish(vagrantcloud.PublishSpec{
+		Version: "1.0.0",
+		Providers: []vagrantcloud.PublishProvider{
+			{Name: vagrantcloud.ProviderVirtualbox, Url: "http://box"},
+			{Name: vagrantcloud.ProviderVmwareDesktop, File: fname, ChecksumType: vagrantcloud.ChecksumSha256},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != vagrantcloud.VersionActive || len(v.Providers) != 2 {
+		t.Fatalf("unexpected version %+v", v)
+	}
+	if err := box.Get(); err != nil || box.ShortDescription != "Test" || len(box.Versions) != 1 {
+		t.Fatalf("unexpected box %+v %v", box, err)
+	}
+	old := api.Box("user", "old")
+	if err := old.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Get(); !vagrantcloud.IsNotFound(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := api.Box("", "nouser").New(); err == nil {
+		t.Fatal("created a box without username")
+	}
+	// tokens are still minted and validated
+	tok, err := api.Authenticate("user", "password", "ci", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Api(tok.Token, vagrantcloud.WithDryRun()).ValidateToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Box("user", "test") != nil || s.Box("user", "old") == nil {
+		t.Fatal("dry run changed the server")
+	}
+	var changes []string
+	for _, c := range api.Changes() {
+		changes = append(changes, c.Method+" "+c.Uri)
+	}
+	want := "POST /boxes," +
+		"POST /box/user/test/versions," +
+		"POST /box/user/test/version/1.0.0/providers," +
+		"POST /box/user/test/version/1.0.0/providers," +
+		"PUT /box/user/test/version/1.0.0/provider/vmware_desktop/upload," +
+		"PUT /box/user/test/version/1.0.0/provider/vmware_desktop," +
+		"PUT /box/user/test/version/1.0.0/release," +
+		"DELETE /box/user/old"
+	if got := strings.Join(changes, ","); got != want {
+		t.Fatalf("unexpected changes\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,703 @@
+// Package vagrantcloudtest provides an in-memory fake of Vagrant Cloud
+// for testing code built on the vagrantcloud package.
+//
+//	s := vagrantcloudtest.NewServer()
+//	defer s.Close()
+//	s.AddUser("user", "token")
+//	api := s.Api("token")
+//	box := api.Box("user", "box")
+//	err := box.New()
+//
+// The fake implements the v1 authenticate, box, version, provider, upload, download,
+// release and revoke endpoints with the validation and status rules of Vagrant Cloud,
+// and can inject latency and failures.
+package vagrantcloudtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/larryli/vagrantcloud.v1"
+)
+
+// Fault makes the server fail matching requests.
+type Fault struct {
+	// Method matches any method if empty.
+	Method string
+	// Path is matched as a prefix of the request path, e.g. "/api/v1/box/user/box";
+	// it matches any path if empty.
+	Path string
+	// Status is the response status, e.g. 503 or 429.
+	Status int
+	// RetryAfter is sent as the Retry-After header if set.
+	RetryAfter time.Duration
+	// Times is the number of requests to fail, 1 if zero.
+	Times int
+}
+
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	users   map[string]string // token to username
+	boxes   map[string]*vagrantcloud.Box
+	uploads map[string]*upload
+	files   map[string][]byte
+	faults  []*Fault
+	latency time.Duration
+	nextId  int
+}
+
+type upload struct {
+	username, name, version string
+	provider                vagrantcloud.ProviderName
+	data                    []byte
+}
+
+// NewServer starts a fake Vagrant Cloud without any users or boxes.
+// Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		users:   map[string]string{},
+		boxes:   map[string]*vagrantcloud.Box{},
+		uploads: map[string]*upload{},
+		files:   map[string][]byte{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddUser lets token act as username.
+// POST /authenticate mints further tokens for username with any password.
+func (s *Server) AddUser(username, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[token] = username
+}
+
+// Api returns an Api talking to the fake with token.
+func (s *Server) Api(token string, opts ...vagrantcloud.Option) *vagrantcloud.Api {
+	return vagrantcloud.New(token, append([]vagrantcloud.Option{vagrantcloud.WithBaseUrl(s.URL)}, opts...)...)
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Inject adds a fault, checked before any request is handled.
+func (s *Server) Inject(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.Times == 0 {
+		f.Times = 1
+	}
+	s.faults = append(s.faults, &f)
+}
+
+// Box returns a copy of the stored box, or nil if there is none.
+func (s *Server) Box(username, name string) *vagrantcloud.Box {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.boxes[username+"/"+name]
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(b)
+	c := &vagrantcloud.Box{}
+	json.Unmarshal(data, c)
+	return c
+}
+
+// File returns the box file uploaded for a provider, or nil.
+func (s *Server) File(username, name, version string, provider vagrantcloud.ProviderName) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[fileKey(username, name, version, provider)]
+}
+
+func fileKey(username, name, version string, provider vagrantcloud.ProviderName) string {
+	return username + "/" + name + "/" + version + "/" + string(provider)
+}
+
+// errorf replies with the error format of Vagrant Cloud.
+func errorf(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJson(w, status, map[string]interface{}{
+		"errors":  []string{fmt.Sprintf(format, args...)},
+		"success": false,
+	})
+}
+
+// invalid replies 422 with a message for field.
+func invalid(w http.ResponseWriter, field, msg string) {
+	writeJson(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"errors":  map[string][]string{field: {msg}},
+		"success": false,
+	})
+}
+
+func notFound(w http.ResponseWriter) {
+	errorf(w, http.StatusNotFound, "Resource not found!")
+}
+
+func writeJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) fault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for n, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method || !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times--; f.Times == 0 {
+			s.faults = append(s.faults[:n], s.faults[n+1:]...)
+		}
+		return f
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if f := s.fault(r); f != nil {
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((f.RetryAfter+time.Second-1)/time.Second)))
+		}
+		errorf(w, f.Status, "%s", http.StatusText(f.Status))
+		return
+	}
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/api/v1/"):
+		s.serveApi(w, r, strings.Split(strings.TrimPrefix(path, "/api/v1/"), "/"))
+	case strings.HasPrefix(path, "/upload/"):
+		s.serveUpload(w, r, strings.TrimPrefix(path, "/upload/"))
+	default:
+		s.serveDownload(w, r, strings.Split(strings.Trim(path, "/"), "/"))
+	}
+}
+
+// user returns the username of the request's access token,
+// "" if it has none, or false if the token is invalid.
+func (s *Server) user(r *http.Request) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		token = r.PostFormValue("access_token")
+	}
+	if token == "" {
+		return "", true
+	}
+	username, ok := s.users[token]
+	return username, ok
+}
+
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) {
+	login := r.PostForm.Get("user[login]")
+	for _, username := range s.users {
+		if username != login {
+			continue
+		}
+		s.nextId++
+		token := "token" + strconv.Itoa(s.nextId)
+		s.users[token] = username
+		writeJson(w, http.StatusOK, map[string]interface{}{
+			"token":       token,
+			"token_hash":  fmt.Sprintf("%x", s.nextId),
+			"description": r.PostForm.Get("token[description]"),
+		})
+		return
+	}
+	errorf(w, http.StatusUnauthorized, "Invalid username or password")
+}
+
+func (s *Server) serveApi(w http.ResponseWriter, r *http.Request, parts []string) {
+	r.ParseForm()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.user(r)
+	if !ok {
+		errorf(w, http.StatusUnauthorized, "Invalid access token")
+		return
+	}
+	route := r.Method + " " + strings.Join(routeParts(parts), "/")
+	switch route {
+	case "GET authenticate":
+		if user == "" {
+			errorf(w, http.StatusUnauthorized, "Invalid access token")
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{})
+		return
+	case "POST authenticate":
+		s.authenticate(w, r)
+		return
+	case "POST boxes":
+		s.createBox(w, r, user)
+		return
+	}
+	if len(parts) < 3 || parts[0] != "box" {
+		notFound(w)
+		return
+	}
+	b, ok := s.boxes[parts[1]+"/"+parts[2]]
+	if !ok || b.Private && b.Username != user {
+		notFound(w)
+		return
+	}
+	if r.Method != "GET" && b.Username != user {
+		// Vagrant Cloud hides what a user may not change
+		notFound(w)
+		return
+	}
+	switch route {
+	case "GET box/:username/:name":
+		s.writeBox(w, b)
+	case "PUT box/:username/:name":
+		s.updateBox(w, r, b)
+	case "DELETE box/:username/:name":
+		delete(s.boxes, b.Username+"/"+b.Name)
+		s.writeBox(w, b)
+	case "POST box/:username/:name/versions":
+		s.createVersion(w, r, b)
+	default:
+		s.serveVersion(w, r, route, b, parts)
+	}
+}
+
+// routeParts replaces the identifiers in a v1 api path by placeholders.
+func routeParts(parts []string) []string {
+	names := []string{"", ":username", ":name", "", ":version", "", ":provider"}
+	route := make([]string, len(parts))
+	for n, part := range parts {
+		route[n] = part
+		if n < len(names) && names[n] != "" {
+			route[n] = names[n]
+		}
+	}
+	return route
+}
+
+var boxName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func (s *Server) createBox(w http.ResponseWriter, r *http.Request, user string) {
+	if user == "" {
+		errorf(w, http.StatusUnauthorized, "Invalid access token")
+		return
+	}
+	username := r.PostForm.Get("box[username]")
+	if username == "" {
+		username = user
+	}
+	if username != user {
+		notFound(w)
+		return
+	}
+	name := r.PostForm.Get("box[name]")
+	switch {
+	case name == "":
+		invalid(w, "name", "can't be blank")
+		return
+	case len(name) > 36:
+		invalid(w, "name", "is too long (maximum is 36 characters)")
+		return
+	case !boxName.MatchString(name):
+		invalid(w, "name", "is invalid")
+		return
+	}
+	if _, ok := s.boxes[username+"/"+name]; ok {
+		invalid(w, "name", "has already been taken")
+		return
+	}
+	now := time.Now().UTC()
+	b := &vagrantcloud.Box{
+		CreatedAt: now,
+		UpdatedAt: now,
+		Tag:       username + "/" + name,
+		Username:  username,
+		Name:      name,
+		Versions:  vagrantcloud.Versions{},
+	}
+	if !s.setBox(w, r, b) {
+		return
+	}
+	s.boxes[b.Tag] = b
+	s.writeBox(w, b)
+}
+
+func (s *Server) updateBox(w http.ResponseWriter, r *http.Request, b *vagrantcloud.Box) {
+	c := *b
+	if !s.setBox(w, r, &c) {
+		return
+	}
+	c.UpdatedAt = time.Now().UTC()
+	*b = c
+	s.writeBox(w, b)
+}
+
+// setBox copies the form fields to b and reports whether they are valid.
+func (s *Server) setBox(w http.ResponseWriter, r *http.Request, b *vagrantcloud.Box) bool {
+	form := r.PostForm
+	if v, ok := form["box[short_description]"]; ok {
+		if len(v[0]) > 120 {
+			invalid(w, "short_description", "is too long (maximum is 120 characters)")
+			return false
+		}
+		b.ShortDescription = v[0]
+	}
+	if v, ok := form["box[description]"]; ok {
+		b.DescriptionMarkdown = v[0]
+		b.DescriptionHtml = "<p>" + v[0] + "</p>"
+	}
+	if v, ok := form["box[is_private]"]; ok {
+		private, err := strconv.ParseBool(v[0])
+		if err != nil {
+			invalid(w, "is_private", "is invalid")
+			return false
+		}
+		b.Private = private
+	}
+	return true
+}
+
+func (s *Server) writeBox(w http.ResponseWriter, b *vagrantcloud.Box) {
+	c := *b
+	c.CurrentVersion = vagrantcloud.Version{}
+	if v := b.LatestVersion(); v != nil {
+		c.CurrentVersion = *v
+	}
+	writeJson(w, http.StatusOK, &c)
+}
+
+func findVersion(b *vagrantcloud.Box, number string) int {
+	for n := range b.Versions {
+		if b.Versions[n].Number == number {
+			return n
+		}
+	}
+	return -1
+}
+
+func (s *Server) createVersion(w http.ResponseWriter, r *http.Request, b *vagrantcloud.Box) {
+	number := r.PostForm.Get("version[version]")
+	if number == "" {
+		invalid(w, "version", "can't be blank")
+		return
+	}
+	if _, err := vagrantcloud.ParseSemVer(number); err != nil {
+		invalid(w, "version", "is invalid")
+		return
+	}
+	if findVersion(b, number) >= 0 {
+		invalid(w, "version", "has already been taken")
+		return
+	}
+	now := time.Now().UTC()
+	v := vagrantcloud.Version{
+		Version:   number,
+		Number:    number,
+		Status:    vagrantcloud.VersionUnreleased,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Providers: []vagrantcloud.Provider{},
+	}
+	s.setVersion(r, &v)
+	v.ReleaseUrl = s.URL + "/api/v1/box/" + b.Tag + "/version/" + number + "/release"
+	v.RevokeUrl = s.URL + "/api/v1/box/" + b.Tag + "/version/" + number + "/revoke"
+	b.Versions = append(b.Versions, v)
+	writeJson(w, http.StatusOK, &v)
+}
+
+func (s *Server) setVersion(r *http.Request, v *vagrantcloud.Version) {
+	if d, ok := r.PostForm["version[description]"]; ok {
+		v.DescriptionMarkdown = d[0]
+		v.DescriptionHtml = "<p>" + d[0] + "</p>"
+	}
+}
+
+func (s *Server) serveVersion(w http.ResponseWriter, r *http.Request, route string, b *vagrantcloud.Box, parts []string) {
+	if len(parts) < 5 || parts[3] != "version" {
+		notFound(w)
+		return
+	}
+	n := findVersion(b, parts[4])
+	if n < 0 {
+		notFound(w)
+		return
+	}
+	v := &b.Versions[n]
+	switch route {
+	case "GET box/:username/:name/version/:version":
+	case "PUT box/:username/:name/version/:version":
+		s.setVersion(r, v)
+		v.UpdatedAt = time.Now().UTC()
+	case "DELETE box/:username/:name/version/:version":
+		if v.Status == vagrantcloud.VersionActive {
+			errorf(w, http.StatusUnprocessableEntity, "Released versions cannot be deleted, revoke them instead")
+			return
+		}
+		c := *v
+		b.Versions = append(b.Versions[:n], b.Versions[n+1:]...)
+		writeJson(w, http.StatusOK, &c)
+		return
+	case "PUT box/:username/:name/version/:version/release":
+		if v.Status != vagrantcloud.VersionUnreleased {
+			errorf(w, http.StatusUnprocessableEntity, "Version is %s and cannot be released", v.Status)
+			return
+		}
+		if len(v.Providers) == 0 {
+			errorf(w, http.StatusUnprocessableEntity, "Version must have at least one provider to be released")
+			return
+		}
+		for _, p := range v.Providers {
+			if p.OriginalUrl == "" && p.HostedToken == "" {
+				errorf(w, http.StatusUnprocessableEntity, "Provider %s has no box uploaded", p.Name)
+				return
+			}
+		}
+		v.Status = vagrantcloud.VersionActive
+	case "PUT box/:username/:name/version/:version/revoke":
+		if v.Status != vagrantcloud.VersionActive {
+			errorf(w, http.StatusUnprocessableEntity, "Version is %s and cannot be revoked", v.Status)
+			return
+		}
+		v.Status = vagrantcloud.VersionRevoked
+	case "POST box/:username/:name/version/:version/providers":
+		s.createProvider(w, r, b, v)
+		return
+	default:
+		s.serveProvider(w, r, route, b, v, parts)
+		return
+	}
+	writeJson(w, http.StatusOK, v)
+}
+
+func findProvider(v *vagrantcloud.Version, name vagrantcloud.ProviderName) int {
+	for n := range v.Providers {
+		if v.Providers[n].Name == name {
+			return n
+		}
+	}
+	return -1
+}
+
+func (s *Server) createProvider(w http.ResponseWriter, r *http.Request, b *vagrantcloud.Box, v *vagrantcloud.Version) {
+	name := vagrantcloud.ProviderName(r.PostForm.Get("provider[name]"))
+	if name == "" {
+		invalid(w, "name", "can't be blank")
+		return
+	}
+	arch := vagrantcloud.Architecture(r.PostForm.Get("provider[architecture]"))
+	for _, p := range v.Providers {
+		if p.Name == name && p.Architecture == arch {
+			invalid(w, "name", "has already been taken")
+			return
+		}
+	}
+	now := time.Now().UTC()
+	p := vagrantcloud.Provider{
+		Name:         name,
+		Architecture: arch,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if !s.setProvider(w, r, b, v, &p) {
+		return
+	}
+	v.Providers = append(v.Providers, p)
+	writeJson(w, http.StatusOK, &p)
+}
+
+// setProvider copies the form fields to p and reports whether they are valid.
+func (s *Server) setProvider(w http.ResponseWriter, r *http.Request, b *vagrantcloud.Box, v *vagrantcloud.Version, p *vagrantcloud.Provider) bool {
+	form := r.PostForm
+	if u, ok := form["provider[url]"]; ok {
+		if u[0] != "" {
+			if parsed, err := url.Parse(u[0]); err != nil || parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+				invalid(w, "url", "is invalid")
+				return false
+			}
+		}
+		p.OriginalUrl = u[0]
+	}
+	if c, ok := form["provider[checksum]"]; ok {
+		t := vagrantcloud.ChecksumType(form.Get("provider[checksum_type]"))
+		if _, err := t.NewHash(); err != nil {
+			invalid(w, "checksum_type", "is invalid")
+			return false
+		}
+		p.Checksum, p.ChecksumType = c[0], t
+	}
+	if d, ok := form["provider[default_architecture]"]; ok {
+		p.DefaultArchitecture, _ = strconv.ParseBool(d[0])
+	}
+	p.Hosted = p.OriginalUrl == ""
+	p.DownloadUrl = p.OriginalUrl
+	if p.Hosted {
+		p.DownloadUrl = s.URL + "/" + b.Tag + "/version/" + v.Number + "/provider/" + string(p.Name) + ".box"
+	}
+	return true
+}
+
+func (s *Server) serveProvider(w http.ResponseWriter, r *http.Request, route string, b *vagrantcloud.Box, v *vagrantcloud.Version, parts []string) {
+	if len(parts) < 7 || parts[5] != "provider" {
+		notFound(w)
+		return
+	}
+	n := findProvider(v, vagrantcloud.ProviderName(parts[6]))
+	if n < 0 {
+		notFound(w)
+		return
+	}
+	p := &v.Providers[n]
+	switch route {
+	case "GET box/:username/:name/version/:version/provider/:provider":
+	case "PUT box/:username/:name/version/:version/provider/:provider":
+		c := *p
+		if !s.setProvider(w, r, b, v, &c) {
+			return
+		}
+		c.UpdatedAt = time.Now().UTC()
+		*p = c
+	case "DELETE box/:username/:name/version/:version/provider/:provider":
+		c := *p
+		v.Providers = append(v.Providers[:n], v.Providers[n+1:]...)
+		delete(s.files, fileKey(b.Username, b.Name, v.Number, c.Name))
+		writeJson(w, http.StatusOK, &c)
+		return
+	case "GET box/:username/:name/version/:version/provider/:provider/upload":
+		s.nextId++
+		id := strconv.Itoa(s.nextId)
+		s.uploads[id] = &upload{
+			username: b.Username,
+			name:     b.Name,
+			version:  v.Number,
+			provider: p.Name,
+		}
+		writeJson(w, http.StatusOK, map[string]string{
+			"upload_path": s.URL + "/upload/" + id,
+			"token":       id,
+		})
+		return
+	default:
+		notFound(w)
+		return
+	}
+	writeJson(w, http.StatusOK, p)
+}
+
+// serveUpload accepts a box file, resuming at the offset of a Content-Range header.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, id string) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok || r.Method != "PUT" {
+		notFound(w)
+		return
+	}
+	size := int64(-1)
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		var first, last int64
+		if _, err := fmt.Sscanf(cr, "bytes */%d", &size); err == nil {
+			// a probe for the confirmed offset
+			if int64(len(u.data)) == size {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if len(u.data) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+			}
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &first, &last, &size); err != nil || first > int64(len(u.data)) {
+			errorf(w, http.StatusRequestedRangeNotSatisfiable, "Invalid Content-Range")
+			return
+		}
+		u.data = append(u.data[:first], data...)
+	} else {
+		u.data = data
+	}
+	if size >= 0 && int64(len(u.data)) < size {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(u.data)-1))
+		w.WriteHeader(http.StatusPermanentRedirect)
+		return
+	}
+	b, ok := s.boxes[u.username+"/"+u.name]
+	if !ok {
+		notFound(w)
+		return
+	}
+	n := findVersion(b, u.version)
+	if n < 0 {
+		notFound(w)
+		return
+	}
+	v := &b.Versions[n]
+	n = findProvider(v, u.provider)
+	if n < 0 {
+		notFound(w)
+		return
+	}
+	p := &v.Providers[n]
+	p.Hosted = true
+	p.HostedToken = id
+	p.OriginalUrl = ""
+	p.DownloadUrl = s.URL + "/" + b.Tag + "/version/" + v.Number + "/provider/" + string(p.Name) + ".box"
+	s.files[fileKey(b.Username, b.Name, v.Number, p.Name)] = u.data
+	delete(s.uploads, id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveDownload serves /:username/:name/version/:version/provider/:provider.box.
+func (s *Server) serveDownload(w http.ResponseWriter, r *http.Request, parts []string) {
+	if r.Method != "GET" && r.Method != "HEAD" || len(parts) != 6 || parts[2] != "version" || parts[4] != "provider" || !strings.HasSuffix(parts[5], ".box") {
+		notFound(w)
+		return
+	}
+	s.mu.Lock()
+	user, _ := s.user(r)
+	b, ok := s.boxes[parts[0]+"/"+parts[1]]
+	var data []byte
+	if ok && (!b.Private || b.Username == user) {
+		data, ok = s.files[fileKey(parts[0], parts[1], parts[3], vagrantcloud.ProviderName(strings.TrimSuffix(parts[5], ".box")))]
+	}
+	s.mu.Unlock()
+	if !ok {
+		notFound(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "vagrant.box", time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,102 @@
+package vagrantcloudtest_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/larryli/vagrantcloud.v1"
+	"github.com/larryli/vagrantcloud.v1/vagrantcloudtest"
+)
+
+func TestServer(t *testing.T) {
+	s := vagrantcloudtest.NewServer()
+	defer s.Close()
+	s.AddUser("user", "token")
+	api := s.Api("token")
+
+	box := api.Box("user", "test")
+	box.ShortDescription = "Test"
+	if err := box.New(); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Box("user", "test").New(); !vagrantcloud.IsConflict(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	version := box.Version("1.0.0")
+	version.Version = "1.0.0"
+	if err := version.New(); err != nil {
+		t.Fatal(err)
+	}
+	if err := version.Release(); err == nil {
+		t.Fatal("released a version without providers")
+	}
+	provider := version.Provider(vagrantcloud.ProviderVirtualbox)
+	if err := provider.New(); err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "test.box")
+	ioutil.WriteFile(fname, []byte("box data"), 0644)
+	provider.ChecksumType = vagrantcloud.ChecksumSha256
+	if err := provider.UploadFile(fname, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := version.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := version.Delete(); err == nil {
+		t.Fatal("deleted a released version")
+	}
+	var buf bytes.Buffer
+	if err := provider.Download(&buf); err != nil || buf.String() != "box data" {
+		t.Fatalf("unexpected download %q %v", buf.String(), err)
+	}
+	b := s.Box("user", "test")
+	if b.ShortDescription != "Test" || b.Versions[0].Status != vagrantcloud.VersionActive || b.Versions[0].Providers[0].Checksum == "" {
+		t.Fatalf("unexpected box %+v", b)
+	}
+	if err := version.Revoke(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Api("wrong").Box("user", "test").Get(); !vagrantcloud.IsUnauthorized(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := api.Box("user", "missing").Get(); !vagrantcloud.IsNotFound(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := vagrantcloudtest.NewServer()
+	defer s.Close()
+	s.AddUser("user", "token")
+	s.Inject(vagrantcloudtest.Fault{Method: "GET", Status: 503, Times: 2})
+	api := s.Api("token", vagrantcloud.WithRetry(vagrantcloud.RetryPolicy{
+		MaxAttempts: 3,
+		MinBackoff:  time.Millisecond,
+	}))
+	box := api.Box("user", "test")
+	if err := box.New(); err != nil {
+		t.Fatal(err)
+	}
+	if err := box.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Inject(vagrantcloudtest.Fault{Status: 429})
+	if err := s.Api("token").Box("user", "test").Get(); !vagrantcloud.IsRateLimited(err) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	s.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	if err := box.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("latency was not applied")
+	}
+}
@@ -1,6 +1,7 @@
 package vagrantcloud
 
 import (
+	"context"
 	"encoding/json"
 	"net/url"
 	"time"
@@ -70,7 +71,11 @@ func (v *Version) Uri() string {
 //		We only require that the string matches a pattern that could be semver,
 //		and don't validate that the version comes after your previous versions, and so on.
 func (v *Version) Get() error {
-	body, err := v.api.Get(v.Uri())
+	return v.GetContext(context.Background())
+}
+
+func (v *Version) GetContext(ctx context.Context) error {
+	body, err := v.api.GetContext(ctx, v.Uri())
 	if err != nil {
 		return err
 	}
@@ -91,16 +96,31 @@ func (v *Version) Get() error {
 //
 // When a version is first created, its status is set to unreleased.
 func (v *Version) New() error {
+	return v.NewContext(context.Background())
+}
+
+func (v *Version) NewContext(ctx context.Context) error {
+	_, err := v.create(ctx)
+	return err
+}
+
+// create is NewContext, reporting whether the version was recovered
+// after a retried POST found it taken, i.e. it may have existed before.
+func (v *Version) create(ctx context.Context) (bool, error) {
 	params := url.Values{}
 	params.Add("version[version]", v.Version)
 	if v.DescriptionMarkdown != "" {
 		params.Add("version[description]", v.DescriptionMarkdown)
 	}
-	body, err := v.api.Post(v.box.Uri()+"/versions", params)
+	body, err := v.api.PostContext(ctx, v.box.Uri()+"/versions", params)
 	if err != nil {
-		return err
+		if createdByRetry(err) {
+			v.Number = v.Version
+			return true, v.GetContext(ctx)
+		}
+		return false, err
 	}
-	return v.parseBody(body)
+	return false, v.parseBody(body)
 }
 
 // UPDATE A VERSION
@@ -118,9 +138,13 @@ func (v *Version) New() error {
 // You cannot modify the status attribute directly,
 // so their are seperate endpoints to revoke and release versions.
 func (v *Version) Set() error {
+	return v.SetContext(context.Background())
+}
+
+func (v *Version) SetContext(ctx context.Context) error {
 	params := url.Values{}
 	params.Add("version[description]", v.DescriptionMarkdown)
-	body, err := v.api.Put(v.Uri(), params)
+	body, err := v.api.PutContext(ctx, v.Uri(), params)
 	if err != nil {
 		return err
 	}
@@ -135,7 +159,11 @@ func (v *Version) Set() error {
 //		We only require that the string matches a pattern that could be semver,
 //		and don't validate that the version comes after your previous versions, and so on.
 func (v *Version) Delete() error {
-	body, err := v.api.Delete(v.Uri())
+	return v.DeleteContext(context.Background())
+}
+
+func (v *Version) DeleteContext(ctx context.Context) error {
+	body, err := v.api.DeleteContext(ctx, v.Uri())
 	if err != nil {
 		return err
 	}
@@ -153,8 +181,12 @@ func (v *Version) Delete() error {
 // This allows you to update the providers and description prior to release.
 // Once a version is ready to release, you can then make a request to move it to an active state.
 func (v *Version) Release() error {
+	return v.ReleaseContext(context.Background())
+}
+
+func (v *Version) ReleaseContext(ctx context.Context) error {
 	params := url.Values{}
-	body, err := v.api.Put(v.Uri()+"/release", params)
+	body, err := v.api.PutContext(ctx, v.Uri()+"/release", params)
 	if err != nil {
 		return err
 	}
@@ -173,8 +205,12 @@ func (v *Version) Release() error {
 // Instead, you should "revoke" a released version, setting the status as revoked.
 // This stops access to the version from Vagrant, but maintains the history of the version.
 func (v *Version) Revoke() error {
+	return v.RevokeContext(context.Background())
+}
+
+func (v *Version) RevokeContext(ctx context.Context) error {
 	params := url.Values{}
-	body, err := v.api.Put(v.Uri()+"/revoke", params)
+	body, err := v.api.PutContext(ctx, v.Uri()+"/revoke", params)
 	if err != nil {
 		return err
 	}